@@ -0,0 +1,157 @@
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// Source addresses allowed and denied, as CIDRs like "10.0.0.0/8" or single
+// IPs. A denied address is refused even if allowed, and when Allow is not
+// empty only the addresses it contains are accepted. The lists only apply to
+// IP sources, not to unix sockets.
+type AccessList struct {
+	Allow []string
+	Deny  []string
+}
+
+// Reported, with OpDenied, for the sources refused by the access lists
+var ErrDenied = errors.New("source address denied")
+
+type accessList struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+//Sets the access list of every listener, it can be replaced while the server
+//runs. A source must be permitted by both this list and the one of its
+//listener, see SetListenerAccessList
+func (s *Server) SetAccessList(acl AccessList) error {
+	parsed, err := parseAccessList(acl)
+	if err != nil {
+		return err
+	}
+
+	s.accessList.Store(parsed)
+	return nil
+}
+
+//Sets the access list of the listeners created for the given address, as
+//given to the Listen methods. It can be replaced while the server runs.
+//Returns ErrUnknownListener when no listener was created for addr
+func (s *Server) SetListenerAccessList(addr string, acl AccessList) error {
+	parsed, err := parseAccessList(acl)
+	if err != nil {
+		return err
+	}
+
+	sources, err := s.sourcesOf(addr)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range sources {
+		src.accessList.Store(parsed)
+	}
+
+	return nil
+}
+
+//When enabled the refused connections and datagrams are reported to the
+//TransportErrorHandler, they are always counted
+func (s *Server) SetReportDenied(report bool) {
+	s.reportDenied = report
+}
+
+// Whether the address is permitted on the listener, the denied sources are
+// counted and reported
+func (s *Server) permitted(addr net.Addr, src *source) bool {
+	var ip net.IP
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+	case *net.UDPAddr:
+		ip = addr.IP
+	default:
+		return true
+	}
+
+	if loadAccessList(&s.accessList).permits(ip) && loadAccessList(&src.accessList).permits(ip) {
+		return true
+	}
+
+	atomic.AddUint64(&src.denied, 1)
+	if s.reportDenied {
+		s.reportTransportError(fmt.Errorf("%w: %s", ErrDenied, ip), OpDenied, addr.String(), src)
+	}
+
+	return false
+}
+
+func parseAccessList(acl AccessList) (*accessList, error) {
+	parsed := &accessList{}
+	for _, entries := range []struct {
+		cidrs []string
+		nets  *[]*net.IPNet
+	}{{acl.Allow, &parsed.allow}, {acl.Deny, &parsed.deny}} {
+		for _, cidr := range entries.cidrs {
+			ipNet, err := parseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			*entries.nets = append(*entries.nets, ipNet)
+		}
+	}
+
+	return parsed, nil
+}
+
+// Parses a CIDR, a single IP being a network of its own
+func parseCIDR(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: cidr}
+		}
+
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	return ipNet, err
+}
+
+func loadAccessList(v *atomic.Value) *accessList {
+	acl, _ := v.Load().(*accessList)
+	return acl
+}
+
+func (acl *accessList) permits(ip net.IP) bool {
+	if acl == nil {
+		return true
+	}
+
+	for _, ipNet := range acl.deny {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(acl.allow) == 0 {
+		return true
+	}
+
+	for _, ipNet := range acl.allow {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
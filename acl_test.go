@@ -0,0 +1,104 @@
+package syslog
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type AccessListSuite struct{}
+
+var _ = Suite(&AccessListSuite{})
+
+func (s *AccessListSuite) TestPermits(c *C) {
+	acl, err := parseAccessList(AccessList{
+		Allow: []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"},
+		Deny:  []string{"10.1.0.0/16"},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(acl.permits(net.ParseIP("10.0.0.1")), Equals, true)
+	c.Check(acl.permits(net.ParseIP("10.1.0.1")), Equals, false)
+	c.Check(acl.permits(net.ParseIP("192.168.1.1")), Equals, true)
+	c.Check(acl.permits(net.ParseIP("192.168.1.2")), Equals, false)
+	c.Check(acl.permits(net.ParseIP("2001:db8::1")), Equals, true)
+	c.Check(acl.permits(net.ParseIP("2001:db9::1")), Equals, false)
+
+	acl, err = parseAccessList(AccessList{Deny: []string{"10.0.0.0/8"}})
+	c.Assert(err, IsNil)
+	c.Check(acl.permits(net.ParseIP("10.0.0.1")), Equals, false)
+	c.Check(acl.permits(net.ParseIP("127.0.0.1")), Equals, true)
+
+	c.Check((*accessList)(nil).permits(net.ParseIP("127.0.0.1")), Equals, true)
+}
+
+func (s *AccessListSuite) TestInvalid(c *C) {
+	server := NewServer()
+	c.Check(server.SetAccessList(AccessList{Allow: []string{"10.0.0.0/33"}}), NotNil)
+	c.Check(server.SetAccessList(AccessList{Deny: []string{"localhost"}}), NotNil)
+	c.Check(server.SetListenerAccessList("127.0.0.1:514", AccessList{Deny: []string{"10.0.0"}}), NotNil)
+	c.Check(server.SetListenerAccessList("127.0.0.1:514", AccessList{}), Equals, ErrUnknownListener)
+}
+
+func (s *AccessListSuite) TestTCP(c *C) {
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(new(HandlerMock))
+	server.SetTransportErrorHandler(recorder.transportError)
+	server.SetReportDenied(true)
+	c.Assert(server.SetAccessList(AccessList{Deny: []string{"127.0.0.0/8"}}), IsNil)
+	c.Assert(server.ListenTCP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	denied := dial(c, server)
+	defer denied.Close()
+	c.Check(closedByPeer(denied), Equals, true)
+
+	c.Assert(server.SetAccessList(AccessList{}), IsNil)
+	permitted := dial(c, server)
+	defer permitted.Close()
+	permitted.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err := permitted.Read(make([]byte, 1))
+	c.Check(err.(net.Error).Timeout(), Equals, true)
+	server.Kill()
+	server.Wait()
+
+	c.Check(server.Stats().Listeners[0].Denied, Equals, uint64(1))
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpDenied)
+	c.Check(errors.Is(recorder.transportErrors[0].Err, ErrDenied), Equals, true)
+	c.Check(recorder.transportErrors[0].Client, Equals, denied.LocalAddr().String())
+}
+
+func (s *AccessListSuite) TestUDP(c *C) {
+	handler := new(handlerRecorder)
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetTransportErrorHandler(recorder.transportError)
+	c.Assert(server.ListenUDP("127.0.0.1:0"), IsNil)
+	c.Assert(server.SetListenerAccessList("127.0.0.1:0", AccessList{Allow: []string{"10.0.0.0/8"}}), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	conn, err := net.Dial("udp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	conn.Write([]byte(exampleSyslog))
+	time.Sleep(50 * time.Millisecond)
+
+	c.Assert(server.SetListenerAccessList("127.0.0.1:0", AccessList{Allow: []string{"127.0.0.1"}}), IsNil)
+	conn.Write([]byte(exampleSyslog))
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Check(handler.logParts, HasLen, 1)
+	c.Check(server.Stats().Listeners[0].Denied, Equals, uint64(1))
+	c.Check(server.Stats().Listeners[0].Datagrams, Equals, uint64(2))
+	// Not reported unless SetReportDenied is enabled
+	c.Check(recorder.transportErrors, HasLen, 0)
+}
@@ -0,0 +1,192 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The first file descriptor passed by systemd, after stdin, stdout and stderr
+const listenFDsStart = 3
+
+var ErrNotSocketActivated = errors.New("no sockets passed by systemd")
+
+//Serves the connections accepted by a listener opened elsewhere, for example
+//before dropping privileges. The listener is named by its address and closed
+//along with the server
+func (s *Server) AddListener(listener net.Listener) error {
+	return s.addListener(listener, listener.Addr().String(), listener.Addr().Network())
+}
+
+//Serves the TLS connections accepted by a listener opened elsewhere
+func (s *Server) AddTLSListener(listener net.Listener, config *tls.Config) error {
+	tlsListener, proxy, err := s.serveTLS(listener, config)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addListener(tlsListener, listener.Addr().String(), "tls"); err != nil {
+		return err
+	}
+	s.sources[tlsListener].proxy = proxy
+
+	return nil
+}
+
+//Receives the datagrams of a packet connection opened elsewhere. The
+//connection is named by its address and closed along with the server
+func (s *Server) AddPacketConn(connection net.PacketConn) error {
+	return s.addPacketConn(connection, connection.LocalAddr().String())
+}
+
+func (s *Server) addListener(listener net.Listener, name, transport string) error {
+	switch transport {
+	case "tcp", "tls", "unix":
+	default:
+		return &net.OpError{Op: "listen", Net: transport, Addr: listener.Addr(), Err: net.UnknownNetworkError(transport)}
+	}
+
+	if transport == "unix" && s.peerCredentials && !credentialsSupported {
+		return ErrCredentialsUnsupported
+	}
+
+	s.addSource(listener, name, listener.Addr().String(), transport)
+	s.sources[listener].credentials = transport == "unix" && s.peerCredentials
+	if transport == "tcp" && s.proxyTrusted != nil {
+		s.sources[listener].proxy = &proxyProtocol{trusted: s.proxyTrusted}
+	}
+
+	s.listeners = append(s.listeners, listener)
+	return nil
+}
+
+func (s *Server) addPacketConn(connection net.PacketConn, name string) error {
+	transport := connection.LocalAddr().Network()
+	switch transport {
+	case "udp", "unixgram":
+	default:
+		return &net.OpError{Op: "listen", Net: transport, Addr: connection.LocalAddr(), Err: net.UnknownNetworkError(transport)}
+	}
+
+	unixConn, ok := connection.(*net.UnixConn)
+	credentials := ok && s.peerCredentials
+	if credentials {
+		if err := enablePassCred(unixConn); err != nil {
+			return err
+		}
+	}
+
+	if buffered, ok := connection.(interface{ SetReadBuffer(int) error }); ok {
+		buffered.SetReadBuffer(datagramReadBufferSize)
+	}
+
+	s.addSource(connection, name, connection.LocalAddr().String(), transport)
+	s.sources[connection].credentials = credentials
+
+	s.connections = append(s.connections, connection)
+	return nil
+}
+
+//Adopts the sockets passed by systemd socket activation, as given by
+//LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES. Every socket is named by its
+//FileDescriptorName, when set, so the per listener settings can refer to it.
+//Returns ErrNotSocketActivated when the process was not given any socket
+func (s *Server) ListenSystemd() error {
+	files, names, err := systemdFiles()
+	if err != nil {
+		return err
+	}
+
+	return s.adoptFiles(files, names)
+}
+
+// Returns the files passed by systemd, and clears the environment so they are
+// not adopted again by a child process
+func systemdFiles() ([]*os.File, []string, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, ErrNotSocketActivated
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil, ErrNotSocketActivated
+	}
+
+	var names []string
+	if fdnames := os.Getenv("LISTEN_FDNAMES"); fdnames != "" {
+		names = strings.Split(fdnames, ":")
+	}
+
+	files := make([]*os.File, count)
+	for i := range files {
+		fd := listenFDsStart + i
+		files[i] = os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+	}
+
+	return files, names, nil
+}
+
+// Adopts the sockets of the given files, closing them as the listeners and
+// connections use duplicates of their descriptors
+func (s *Server) adoptFiles(files []*os.File, names []string) error {
+	for i, file := range files {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+
+		err := s.adoptFile(file, name)
+		file.Close()
+		if err != nil {
+			for _, file := range files[i+1:] {
+				file.Close()
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) adoptFile(file *os.File, name string) error {
+	// Datagram unix sockets are given as listeners too, so the network is
+	// checked before taking one
+	if listener, err := net.FileListener(file); err == nil {
+		if network := listener.Addr().Network(); network == "tcp" || network == "unix" {
+			if name == "" {
+				name = listener.Addr().String()
+			}
+			if err := s.addListener(listener, name, network); err != nil {
+				listener.Close()
+				return err
+			}
+			s.sourceOf(listener, nil).setName(name)
+			return nil
+		}
+		listener.Close()
+	}
+
+	connection, err := net.FilePacketConn(file)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		name = connection.LocalAddr().String()
+	}
+	if err := s.addPacketConn(connection, name); err != nil {
+		connection.Close()
+		return err
+	}
+	s.sourceOf(connection, nil).setName(name)
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package syslog
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type AdoptSuite struct{}
+
+var _ = Suite(&AdoptSuite{})
+
+func (s *AdoptSuite) TestAddListenerAndPacketConn(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	connection, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	c.Assert(server.AddListener(listener), IsNil)
+	c.Assert(server.AddPacketConn(connection), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	for _, addr := range []net.Addr{listener.Addr(), connection.LocalAddr()} {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		c.Assert(err, IsNil)
+		conn.Write([]byte(exampleSyslog + "\n"))
+		conn.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 2)
+	transports := map[string]bool{}
+	for _, listener := range server.Stats().Listeners {
+		transports[listener.Transport] = true
+	}
+	c.Check(transports, DeepEquals, map[string]bool{"tcp": true, "udp": true})
+}
+
+func (s *AdoptSuite) TestAdoptFiles(c *C) {
+	dir := c.MkDir()
+	tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(err, IsNil)
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(err, IsNil)
+	unixPath, unixgramPath := filepath.Join(dir, "stream"), filepath.Join(dir, "dgram")
+	unix, err := net.ListenUnix("unix", &net.UnixAddr{Name: unixPath, Net: "unix"})
+	c.Assert(err, IsNil)
+	unix.SetUnlinkOnClose(false)
+	unixgram, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: unixgramPath, Net: "unixgram"})
+	c.Assert(err, IsNil)
+
+	var files []*os.File
+	for _, socket := range []interface {
+		File() (*os.File, error)
+		Close() error
+	}{tcp, udp, unix, unixgram} {
+		file, err := socket.File()
+		c.Assert(err, IsNil)
+		files = append(files, file)
+		socket.Close()
+	}
+
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetIncludeMetadata(true)
+	c.Assert(server.adoptFiles(files, []string{"syslog-tcp", "syslog-udp"}), IsNil)
+	c.Assert(server.SetListenerName("syslog-udp", "udp"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	for _, addr := range []net.Addr{tcp.Addr(), udp.LocalAddr(), unix.Addr(), unixgram.LocalAddr()} {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		c.Assert(err, IsNil)
+		conn.Write([]byte(exampleSyslog + "\n"))
+		conn.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 4)
+	names := map[string]string{}
+	for _, logParts := range handler.logParts {
+		names[logParts["listener"].(string)] = logParts["transport"].(string)
+	}
+	c.Check(names, DeepEquals, map[string]string{
+		"syslog-tcp": "tcp",
+		"udp":        "udp",
+		unixPath:     "unix",
+		unixgramPath: "unixgram",
+	})
+}
+
+func (s *AdoptSuite) TestNotSocketActivated(c *C) {
+	server := NewServer()
+	os.Unsetenv("LISTEN_PID")
+	c.Check(server.ListenSystemd(), Equals, ErrNotSocketActivated)
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	c.Check(server.ListenSystemd(), Equals, ErrNotSocketActivated)
+	c.Check(os.Getenv("LISTEN_FDS"), Equals, "")
+	c.Check(server.LocalAddrs(), HasLen, 0)
+}
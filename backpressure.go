@@ -0,0 +1,107 @@
+package syslog
+
+import (
+	"sync/atomic"
+)
+
+// What to do with a datagram when the queue between the socket readers and
+// the parsers is full
+type DropPolicy int
+
+const (
+	// Wait for room in the queue, the socket is not read meanwhile
+	BlockPolicy DropPolicy = iota
+	// Discard the datagram just received
+	DropNewestPolicy
+	// Discard the oldest queued datagram to make room for the new one
+	DropOldestPolicy
+	// Hand the datagram to the OverflowFunc instead of queueing it
+	OverflowPolicy
+)
+
+// Receives the datagrams that did not fit in the queue with OverflowPolicy.
+// The message buffer is reused once the function returns
+type OverflowFunc func(message []byte, client string)
+
+// Datagrams lost or spilled on a listener
+type DropStats struct {
+	Dropped    uint64
+	Overflowed uint64
+}
+
+//Sets what happens to the datagrams received while the queue is full,
+//BlockPolicy by default
+func (s *Server) SetDropPolicy(policy DropPolicy) {
+	s.dropPolicy = policy
+}
+
+//Sets the function receiving the datagrams spilled by OverflowPolicy
+func (s *Server) SetOverflowFunc(overflowFunc OverflowFunc) {
+	s.overflowFunc = overflowFunc
+}
+
+//Returns the datagrams dropped or spilled so far, by listener name
+func (s *Server) DropStats() map[string]DropStats {
+	dropStats := make(map[string]DropStats)
+	for _, listener := range s.Stats().Listeners {
+		stats := dropStats[listener.Listener]
+		stats.Dropped += listener.Dropped
+		stats.Overflowed += listener.Overflowed
+		dropStats[listener.Listener] = stats
+	}
+
+	return dropStats
+}
+
+func (s *Server) enqueueDatagram(msg DatagramMessage) {
+	switch s.dropPolicy {
+	case DropNewestPolicy:
+		select {
+		case s.datagramChannel <- msg:
+		default:
+			s.dropDatagram(msg)
+		}
+	case DropOldestPolicy:
+		for {
+			select {
+			case s.datagramChannel <- msg:
+				return
+			default:
+			}
+
+			// An unbuffered queue holds nothing to evict
+			if cap(s.datagramChannel) == 0 {
+				s.dropDatagram(msg)
+				return
+			}
+
+			select {
+			case old := <-s.datagramChannel:
+				s.dropDatagram(old)
+			default:
+			}
+		}
+	case OverflowPolicy:
+		select {
+		case s.datagramChannel <- msg:
+		default:
+			if msg.source != nil {
+				atomic.AddUint64(&msg.source.overflowed, 1)
+			}
+			if s.overflowFunc != nil {
+				s.overflowFunc(msg.message, msg.client)
+			}
+			s.datagramPool.Put(msg.message[:cap(msg.message)])
+		}
+	default:
+		s.datagramChannel <- msg
+	}
+}
+
+// Counts the datagram as dropped and recycles its buffer
+func (s *Server) dropDatagram(msg DatagramMessage) {
+	if msg.source != nil {
+		atomic.AddUint64(&msg.source.dropped, 1)
+	}
+	s.datagramPool.Put(msg.message[:cap(msg.message)])
+}
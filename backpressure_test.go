@@ -0,0 +1,128 @@
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type BackpressureSuite struct{}
+
+var _ = Suite(&BackpressureSuite{})
+
+// Returns the content of the messages handled
+func (s *BackpressureSuite) contents(handler *handlerBlocking) []string {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	var contents []string
+	for _, logParts := range handler.logParts {
+		contents = append(contents, logParts["content"].(string))
+	}
+
+	return contents
+}
+
+// Sends a first datagram that blocks the handler, then four more while the
+// queue, of size one, can only hold one of them
+func (s *BackpressureSuite) flood(c *C, server *Server) {
+	conn, err := net.Dial("udp", server.connections[0].LocalAddr().String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(exampleSyslog + "1"))
+	c.Assert(err, IsNil)
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 2; i <= 5; i++ {
+		_, err = conn.Write([]byte(fmt.Sprintf("%s%d", exampleSyslog, i)))
+		c.Assert(err, IsNil)
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+func (s *BackpressureSuite) newServer(c *C, policy DropPolicy) (*Server, *handlerBlocking) {
+	handler := &handlerBlocking{release: make(chan struct{})}
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetDatagramChannelSize(1)
+	server.SetDropPolicy(policy)
+	c.Assert(server.ListenUDP("127.0.0.1:0"), IsNil)
+	return server, handler
+}
+
+func (s *BackpressureSuite) TestDropNewest(c *C) {
+	server, handler := s.newServer(c, DropNewestPolicy)
+	c.Assert(server.Boot(), IsNil)
+	s.flood(c, server)
+
+	listener := server.connections[0].LocalAddr().String()
+	c.Check(server.DropStats()[listener], Equals, DropStats{Dropped: 3})
+
+	close(handler.release)
+	server.Kill()
+	server.Wait()
+	c.Check(s.contents(handler), DeepEquals, []string{"content1", "content2"})
+}
+
+func (s *BackpressureSuite) TestDropOldest(c *C) {
+	server, handler := s.newServer(c, DropOldestPolicy)
+	c.Assert(server.Boot(), IsNil)
+	s.flood(c, server)
+
+	listener := server.connections[0].LocalAddr().String()
+	c.Check(server.DropStats()[listener], Equals, DropStats{Dropped: 3})
+
+	close(handler.release)
+	server.Kill()
+	server.Wait()
+	c.Check(s.contents(handler), DeepEquals, []string{"content1", "content5"})
+}
+
+func (s *BackpressureSuite) TestOverflow(c *C) {
+	server, handler := s.newServer(c, OverflowPolicy)
+	var spilled []string
+	server.SetOverflowFunc(func(message []byte, client string) {
+		spilled = append(spilled, string(message))
+	})
+	c.Assert(server.Boot(), IsNil)
+	s.flood(c, server)
+
+	listener := server.connections[0].LocalAddr().String()
+	c.Check(server.DropStats()[listener], Equals, DropStats{Overflowed: 3})
+
+	close(handler.release)
+	server.Kill()
+	server.Wait()
+	c.Check(s.contents(handler), DeepEquals, []string{"content1", "content2"})
+	c.Check(spilled, DeepEquals, []string{exampleSyslog + "3", exampleSyslog + "4", exampleSyslog + "5"})
+}
+
+func (s *BackpressureSuite) TestDropOldestUnbuffered(c *C) {
+	server, handler := s.newServer(c, DropOldestPolicy)
+	server.SetDatagramChannelSize(0)
+	c.Assert(server.Boot(), IsNil)
+	s.flood(c, server)
+
+	listener := server.connections[0].LocalAddr().String()
+	c.Check(server.DropStats()[listener], Equals, DropStats{Dropped: 4})
+
+	close(handler.release)
+	server.Kill()
+	server.Wait()
+	c.Check(s.contents(handler), DeepEquals, []string{"content1"})
+}
+
+func (s *BackpressureSuite) TestWithoutSource(c *C) {
+	for _, policy := range []DropPolicy{DropNewestPolicy, DropOldestPolicy, OverflowPolicy} {
+		server := NewServer()
+		server.SetDropPolicy(policy)
+		server.datagramChannel = make(chan DatagramMessage, 1)
+		server.enqueueDatagram(DatagramMessage{message: []byte(exampleSyslog + "1")})
+		server.enqueueDatagram(DatagramMessage{message: []byte(exampleSyslog + "2")})
+		c.Check(server.datagramChannel, HasLen, 1, Commentf("policy %d", policy))
+	}
+}
@@ -0,0 +1,232 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrInvalidCABundle = errors.New("no certificate found in the CA bundle")
+
+// Receives the errors of the reloads, the previous certificates are kept
+type ReloadErrorFunc func(err error)
+
+// CertificateProvider serves the certificate, key and client CA bundle read
+// from files, reloading them when they change so the TLS listeners pick the
+// new material on the next handshakes without being restarted.
+type CertificateProvider struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	stamps      []fileStamp
+	errorFunc   ReloadErrorFunc
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertificateProvider reads the certificate and its key, and the client CA
+// bundle if caFile is not empty
+func NewCertificateProvider(certFile, keyFile, caFile string) (*CertificateProvider, error) {
+	p := &CertificateProvider{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+//Sets the function called when a reload fails
+func (p *CertificateProvider) SetReloadErrorFunc(errorFunc ReloadErrorFunc) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.errorFunc = errorFunc
+}
+
+// Reload reads the files again, on error the previous material is kept
+func (p *CertificateProvider) Reload() error {
+	stamps := p.statFiles()
+
+	certificate, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if p.caFile != "" {
+		bundle, err := ioutil.ReadFile(p.caFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(bundle) {
+			return fmt.Errorf("%w: %s", ErrInvalidCABundle, p.caFile)
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.certificate = &certificate
+	p.clientCAs = clientCAs
+	p.stamps = stamps
+
+	return nil
+}
+
+// GetCertificate returns the current certificate, it can be used as the
+// tls.Config function of the same name
+func (p *CertificateProvider) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.certificate, nil
+}
+
+// TLSConfig returns a copy of config, which may be nil, serving the current
+// certificate and client CA pool on every handshake. The GetConfigForClient
+// of config, if any, is still called and the config it returns, unless nil,
+// is the one given the certificate and client CA pool
+func (p *CertificateProvider) TLSConfig(config *tls.Config) *tls.Config {
+	base := &tls.Config{}
+	if config != nil {
+		base = config.Clone()
+	}
+
+	result := base.Clone()
+	getConfigForClient := base.GetConfigForClient
+	result.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		handshake := base
+		if getConfigForClient != nil {
+			config, err := getConfigForClient(hello)
+			if err != nil {
+				return nil, err
+			}
+			if config != nil {
+				handshake = config
+			}
+		}
+
+		p.mutex.RLock()
+		defer p.mutex.RUnlock()
+
+		handshake = handshake.Clone()
+		handshake.Certificates = []tls.Certificate{*p.certificate}
+		if p.clientCAs != nil {
+			handshake.ClientCAs = p.clientCAs
+		}
+
+		return handshake, nil
+	}
+
+	return result
+}
+
+// Watch reloads the files every interval when they changed, and on SIGHUP,
+// until ctx is done. A change is picked once the files stayed the same for an
+// interval, so a certificate and its key are not read halfway through their
+// rotation. Failed reloads go to the ReloadErrorFunc.
+func (p *CertificateProvider) Watch(ctx context.Context, interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pending []fileStamp
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			p.reload()
+			pending = nil
+		case <-ticker.C:
+			stamps := p.statFiles()
+			switch {
+			case !p.changed(stamps):
+				pending = nil
+			case sameStamps(stamps, pending):
+				p.reload()
+				pending = nil
+			default:
+				pending = stamps
+			}
+		}
+	}
+}
+
+func (p *CertificateProvider) reload() {
+	stamps := p.statFiles()
+	err := p.Reload()
+	if err == nil {
+		return
+	}
+
+	// The files changed meanwhile, they are read again once settled
+	if !sameStamps(stamps, p.statFiles()) {
+		return
+	}
+
+	// Reported once, until the files change again
+	p.mutex.Lock()
+	p.stamps = stamps
+	errorFunc := p.errorFunc
+	p.mutex.Unlock()
+
+	if errorFunc != nil {
+		errorFunc(err)
+	}
+}
+
+// Whether the files changed since they were last read
+func (p *CertificateProvider) changed(stamps []fileStamp) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return !sameStamps(stamps, p.stamps)
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *CertificateProvider) statFiles() []fileStamp {
+	stamps := make([]fileStamp, 3)
+	for i, file := range []string{p.certFile, p.keyFile, p.caFile} {
+		if file == "" {
+			continue
+		}
+
+		if info, err := os.Stat(file); err == nil {
+			stamps[i] = fileStamp{info.ModTime(), info.Size()}
+		}
+	}
+
+	return stamps
+}
@@ -0,0 +1,253 @@
+package syslog
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/internal/testcert"
+)
+
+type CertificatesSuite struct{}
+
+var _ = Suite(&CertificatesSuite{})
+
+// Writes the certificate and its key as PEM files
+func writeCertificate(c *C, certificate tls.Certificate, certFile, keyFile string) {
+	var cert bytes.Buffer
+	c.Assert(pem.Encode(&cert, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), IsNil)
+	c.Assert(ioutil.WriteFile(certFile, cert.Bytes(), 0600), IsNil)
+
+	der, err := x509.MarshalECPrivateKey(certificate.PrivateKey.(*ecdsa.PrivateKey))
+	c.Assert(err, IsNil)
+	var key bytes.Buffer
+	c.Assert(pem.Encode(&key, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), IsNil)
+	c.Assert(ioutil.WriteFile(keyFile, key.Bytes(), 0600), IsNil)
+}
+
+// Returns the certificate served by the TLS listener at addr
+func servedCertificate(c *C, addr string) []byte {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].Raw
+}
+
+func (s *CertificatesSuite) TestReload(c *C) {
+	dir := c.MkDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := testcert.SelfSigned(c, "first.example.com")
+	writeCertificate(c, first, certFile, keyFile)
+
+	provider, err := NewCertificateProvider(certFile, keyFile, "")
+	c.Assert(err, IsNil)
+
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(new(HandlerMock))
+	c.Assert(server.ListenTCPTLS("127.0.0.1:0", provider.TLSConfig(nil)), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+	addr := server.LocalAddrs()[0].String()
+
+	established, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	c.Assert(err, IsNil)
+	defer established.Close()
+	c.Check(servedCertificate(c, addr), DeepEquals, first.Certificate[0])
+
+	second := testcert.SelfSigned(c, "second.example.com")
+	writeCertificate(c, second, certFile, keyFile)
+	c.Assert(provider.Reload(), IsNil)
+	c.Check(servedCertificate(c, addr), DeepEquals, second.Certificate[0])
+
+	_, err = established.Write([]byte(octetFrame(exampleRFC5424Syslog)))
+	c.Check(err, IsNil)
+}
+
+func (s *CertificatesSuite) TestReloadError(c *C) {
+	dir := c.MkDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := testcert.SelfSigned(c, "first.example.com")
+	writeCertificate(c, first, certFile, keyFile)
+
+	provider, err := NewCertificateProvider(certFile, keyFile, "")
+	c.Assert(err, IsNil)
+
+	c.Assert(ioutil.WriteFile(keyFile, []byte("garbage"), 0600), IsNil)
+	c.Check(provider.Reload(), NotNil)
+
+	certificate, err := provider.GetCertificate(nil)
+	c.Assert(err, IsNil)
+	c.Check(certificate.Certificate[0], DeepEquals, first.Certificate[0])
+}
+
+func (s *CertificatesSuite) TestTLSConfigGetConfigForClient(c *C) {
+	dir := c.MkDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := testcert.SelfSigned(c, "first.example.com")
+	writeCertificate(c, first, certFile, keyFile)
+
+	provider, err := NewCertificateProvider(certFile, keyFile, "")
+	c.Assert(err, IsNil)
+
+	// The config of the user is given the certificate of the provider
+	config := provider.TLSConfig(&tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if hello.ServerName == "refused.example.com" {
+				return nil, errors.New("refused")
+			}
+			return &tls.Config{NextProtos: []string{"syslog"}}, nil
+		},
+	})
+
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(new(HandlerMock))
+	c.Assert(server.ListenTCPTLS("127.0.0.1:0", config), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+	addr := server.LocalAddrs()[0].String()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"syslog"}})
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	c.Check(conn.ConnectionState().NegotiatedProtocol, Equals, "syslog")
+	c.Check(conn.ConnectionState().PeerCertificates[0].Raw, DeepEquals, first.Certificate[0])
+
+	_, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, ServerName: "refused.example.com"})
+	c.Check(err, NotNil)
+}
+
+func (s *CertificatesSuite) TestInvalidCABundle(c *C) {
+	dir := c.MkDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	writeCertificate(c, testcert.SelfSigned(c, "first.example.com"), certFile, keyFile)
+	c.Assert(ioutil.WriteFile(caFile, []byte("garbage"), 0600), IsNil)
+
+	_, err := NewCertificateProvider(certFile, keyFile, caFile)
+	c.Check(errors.Is(err, ErrInvalidCABundle), Equals, true)
+}
+
+func (s *CertificatesSuite) TestWatch(c *C) {
+	dir := c.MkDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(c, testcert.SelfSigned(c, "first.example.com"), certFile, keyFile)
+
+	provider, err := NewCertificateProvider(certFile, keyFile, "")
+	c.Assert(err, IsNil)
+
+	var mutex sync.Mutex
+	var errs []error
+	provider.SetReloadErrorFunc(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		errs = append(errs, err)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		provider.Watch(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	// The modification times are moved forward, as the files may be
+	// rewritten within the resolution of the file system
+	touch := func(files ...string) {
+		future := time.Now().Add(time.Hour)
+		for _, file := range files {
+			c.Assert(os.Chtimes(file, future, future), IsNil)
+		}
+	}
+
+	second := testcert.SelfSigned(c, "second.example.com")
+	writeCertificate(c, second, certFile, keyFile)
+	touch(certFile, keyFile)
+	time.Sleep(100 * time.Millisecond)
+
+	certificate, _ := provider.GetCertificate(nil)
+	c.Check(certificate.Certificate[0], DeepEquals, second.Certificate[0])
+
+	c.Assert(ioutil.WriteFile(keyFile, []byte("garbage"), 0600), IsNil)
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+	<-done
+
+	certificate, _ = provider.GetCertificate(nil)
+	c.Check(certificate.Certificate[0], DeepEquals, second.Certificate[0])
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	c.Check(errs, HasLen, 1)
+}
+
+// Writes the certificate of a CA as a PEM bundle
+func writeCABundle(c *C, caCert *x509.Certificate, caFile string) {
+	var bundle bytes.Buffer
+	c.Assert(pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw}), IsNil)
+	c.Assert(ioutil.WriteFile(caFile, bundle.Bytes(), 0600), IsNil)
+}
+
+func (s *CertificatesSuite) TestRFC5425DNSNames(c *C) {
+	dir := c.MkDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	writeCertificate(c, testcert.SelfSigned(c, "server.example.com"), certFile, keyFile)
+	firstCA, firstCACert := testcert.Authority(c)
+	writeCABundle(c, firstCACert, caFile)
+
+	provider, err := NewCertificateProvider(certFile, keyFile, caFile)
+	c.Assert(err, IsNil)
+
+	handler := new(handlerRecorder)
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	server.SetTransportErrorHandler(recorder.transportError)
+	peers := PeerAuthorization{DNSNames: []string{"*.example.com"}}
+	c.Assert(server.ListenRFC5425("127.0.0.1:0", provider.TLSConfig(nil), peers), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	addr := server.LocalAddrs()[0].String()
+
+	send := func(client tls.Certificate) {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{
+			Certificates:       []tls.Certificate{client},
+			InsecureSkipVerify: true,
+		})
+		c.Assert(err, IsNil)
+		conn.Write([]byte(octetFrame(exampleRFC5424Syslog)))
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}
+
+	first := testcert.Signed(c, firstCA, firstCACert, "first.example.com")
+	send(first)
+
+	// The peers are then verified against the CA bundle reloaded
+	secondCA, secondCACert := testcert.Authority(c)
+	writeCABundle(c, secondCACert, caFile)
+	c.Assert(provider.Reload(), IsNil)
+	send(first)
+	send(testcert.Signed(c, secondCA, secondCACert, "second.example.com"))
+
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.logParts[0]["tls_peer"], Equals, "first.example.com")
+	c.Check(handler.logParts[1]["tls_peer"], Equals, "second.example.com")
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpPeer)
+}
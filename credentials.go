@@ -0,0 +1,85 @@
+package syslog
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+var ErrCredentialsUnsupported = errors.New("peer credentials are not supported on this platform")
+
+// Credentials of the process which sent a message on a unix socket
+type peerCredentials struct {
+	pid int
+	uid int
+	gid int
+}
+
+//Adds to the messages received on unix sockets the pid, uid and gid of the
+//sending process, as given by the kernel (SCM_CREDENTIALS for the datagrams
+//and SO_PEERCRED for the stream connections). It applies to the unix sockets
+//opened afterwards. Linux only, elsewhere the unix Listen methods fail with
+//ErrCredentialsUnsupported
+func (s *Server) SetPeerCredentials(enabled bool) {
+	s.peerCredentials = enabled
+}
+
+//Adds as well the comm, exe and cgroup of the sending process, read from /proc
+//for every message. They are missing if the process is already gone
+func (s *Server) SetProcessInfo(enabled bool) {
+	s.processInfo = enabled
+}
+
+func (s *Server) addCredentials(logParts format.LogParts, credentials *peerCredentials) {
+	if credentials == nil {
+		return
+	}
+
+	logParts["pid"] = credentials.pid
+	logParts["uid"] = credentials.uid
+	logParts["gid"] = credentials.gid
+
+	if !s.processInfo {
+		return
+	}
+
+	proc := "/proc/" + strconv.Itoa(credentials.pid)
+	if comm, err := ioutil.ReadFile(proc + "/comm"); err == nil {
+		logParts["comm"] = strings.TrimSuffix(string(comm), "\n")
+	}
+
+	if exe, err := os.Readlink(proc + "/exe"); err == nil {
+		logParts["exe"] = exe
+	}
+
+	if cgroup, err := ioutil.ReadFile(proc + "/cgroup"); err == nil {
+		logParts["cgroup"] = parseCgroup(string(cgroup))
+	}
+}
+
+// Returns the cgroup path of the unified hierarchy, or the first one listed
+// with cgroups v1
+func parseCgroup(cgroup string) string {
+	var first string
+	for _, line := range strings.Split(strings.TrimSpace(cgroup), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+
+		if first == "" {
+			first = parts[2]
+		}
+	}
+
+	return first
+}
@@ -0,0 +1,81 @@
+//go:build linux
+// +build linux
+
+package syslog
+
+import (
+	"net"
+	"syscall"
+)
+
+const credentialsSupported = true
+
+// Size of the out-of-band data holding the credentials of a datagram
+var credentialsBufferSize = syscall.CmsgSpace(syscall.SizeofUcred)
+
+// Asks the kernel for the credentials of the senders of the datagrams
+func enablePassCred(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
+
+// Reads a datagram along with the credentials of its sender, oob must be of
+// credentialsBufferSize
+func readWithCredentials(conn *net.UnixConn, buf, oob []byte) (int, net.Addr, *peerCredentials, error) {
+	n, oobn, _, addr, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return n, nil, nil, err
+	}
+
+	var credentials *peerCredentials
+	if messages, err := syscall.ParseSocketControlMessage(oob[:oobn]); err == nil {
+		for _, message := range messages {
+			if ucred, err := syscall.ParseUnixCredentials(&message); err == nil {
+				credentials = &peerCredentials{int(ucred.Pid), int(ucred.Uid), int(ucred.Gid)}
+				break
+			}
+		}
+	}
+
+	// Unbound senders have no address, which must not end as a typed nil
+	if addr == nil {
+		return n, nil, credentials, nil
+	}
+
+	return n, addr, credentials, nil
+}
+
+// Returns the credentials of the process which connected to a unix stream
+// socket
+func connectionCredentials(conn *net.UnixConn) (*peerCredentials, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var ucred *syscall.Ucred
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, sockErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sockErr != nil {
+		return nil, sockErr
+	}
+
+	return &peerCredentials{int(ucred.Pid), int(ucred.Uid), int(ucred.Gid)}, nil
+}
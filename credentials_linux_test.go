@@ -0,0 +1,103 @@
+//go:build linux
+// +build linux
+
+package syslog
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+type CredentialsSuite struct{}
+
+var _ = Suite(&CredentialsSuite{})
+
+// Sends a message to the unix socket at path and returns what the handler got
+func receiveWithCredentials(c *C, network, path string, listen func(*Server) error) []format.LogParts {
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetPeerCredentials(true)
+	server.SetProcessInfo(true)
+	c.Assert(listen(server), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	conn, err := net.Dial(network, path)
+	c.Assert(err, IsNil)
+	_, err = conn.Write([]byte(exampleSyslog + "\n"))
+	c.Assert(err, IsNil)
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	return handler.logParts
+}
+
+func (s *CredentialsSuite) checkCredentials(c *C, received []format.LogParts) {
+	c.Assert(received, HasLen, 1)
+	logParts := received[0]
+	c.Check(logParts["content"], Equals, "content")
+	c.Check(logParts["pid"], Equals, os.Getpid())
+	c.Check(logParts["uid"], Equals, os.Getuid())
+	c.Check(logParts["gid"], Equals, os.Getgid())
+
+	exe, err := os.Executable()
+	c.Assert(err, IsNil)
+	c.Check(logParts["exe"], Equals, exe)
+	c.Check(logParts["comm"], Not(Equals), "")
+	c.Check(logParts["cgroup"], Matches, "/.*")
+}
+
+func (s *CredentialsSuite) TestUnixgram(c *C) {
+	path := filepath.Join(c.MkDir(), "log")
+	received := receiveWithCredentials(c, "unixgram", path, func(server *Server) error {
+		return server.ListenUnixgram(path)
+	})
+	s.checkCredentials(c, received)
+}
+
+func (s *CredentialsSuite) TestUnix(c *C) {
+	path := filepath.Join(c.MkDir(), "log")
+	received := receiveWithCredentials(c, "unix", path, func(server *Server) error {
+		return server.ListenUnix(path)
+	})
+	s.checkCredentials(c, received)
+}
+
+func (s *CredentialsSuite) TestWithoutCredentials(c *C) {
+	path := filepath.Join(c.MkDir(), "log")
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	c.Assert(server.ListenUnixgram(path), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	conn, err := net.Dial("unixgram", path)
+	c.Assert(err, IsNil)
+	conn.Write([]byte(exampleSyslog))
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 1)
+	for _, logParts := range handler.logParts {
+		_, ok := logParts["pid"]
+		c.Check(ok, Equals, false)
+	}
+}
+
+func (s *CredentialsSuite) TestParseCgroup(c *C) {
+	c.Check(parseCgroup("0::/user.slice/session-1.scope\n"), Equals, "/user.slice/session-1.scope")
+	c.Check(parseCgroup("12:cpu,cpuacct:/system.slice\n1:name=systemd:/init.scope\n0::/init.scope\n"), Equals, "/init.scope")
+	c.Check(parseCgroup("12:cpu,cpuacct:/system.slice\n1:name=systemd:/init.scope\n"), Equals, "/system.slice")
+	c.Check(parseCgroup(""), Equals, "")
+}
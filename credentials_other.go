@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package syslog
+
+import (
+	"net"
+)
+
+const credentialsSupported = false
+
+var credentialsBufferSize = 0
+
+func enablePassCred(conn *net.UnixConn) error {
+	return ErrCredentialsUnsupported
+}
+
+func readWithCredentials(conn *net.UnixConn, buf, oob []byte) (int, net.Addr, *peerCredentials, error) {
+	return 0, nil, nil, ErrCredentialsUnsupported
+}
+
+func connectionCredentials(conn *net.UnixConn) (*peerCredentials, error) {
+	return nil, ErrCredentialsUnsupported
+}
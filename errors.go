@@ -0,0 +1,111 @@
+package syslog
+
+import (
+	"fmt"
+	"time"
+)
+
+// Operations reported by a TransportError
+const (
+	OpAccept    = "accept"
+	OpHandshake = "handshake"
+	OpPeer      = "peer"
+	OpRead      = "read"
+	OpFrame     = "frame"
+	OpLimit     = "limit"
+	OpDenied    = "denied"
+	OpProxy     = "proxy"
+)
+
+// A message that could not be parsed, it is still handed to the Handler. Raw
+// is the message as handed to the parser, see SetIncludeMetadata
+type ParseError struct {
+	Err       error
+	Raw       []byte
+	Client    string
+	Listener  string
+	Transport string
+	// Byte offset of Raw where the parser stopped, -1 if unknown
+	Offset int
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("syslog: parse error from %s on %s/%s at offset %d: %v", e.Client, e.Transport, e.Listener, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// An error of the transport, the connection or datagram concerned is lost
+type TransportError struct {
+	Err       error
+	Op        string
+	Client    string
+	Listener  string
+	Transport string
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("syslog: %s error from %s on %s/%s: %v", e.Op, e.Client, e.Transport, e.Listener, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Receives every parse error, along with the raw message which is a copy the
+// function may keep
+type ErrorHandler func(*ParseError)
+
+// Receives the accept, TLS handshake, read, oversized frame, connection limit
+// and PROXY protocol errors
+type TransportErrorHandler func(*TransportError)
+
+//Sets the function called for every message that fails to parse
+func (s *Server) SetErrorHandler(errorHandler ErrorHandler) {
+	s.errorHandler = errorHandler
+}
+
+//Sets the function called on accept, handshake and read errors
+func (s *Server) SetTransportErrorHandler(transportErrorHandler TransportErrorHandler) {
+	s.transportErrorHandler = transportErrorHandler
+}
+
+func (s *Server) reportParseError(err error, line []byte, client string, src *source, offset int) {
+	s.lastErrorMutex.Lock()
+	s.lastError = err
+	s.lastErrorMutex.Unlock()
+
+	if s.errorHandler == nil {
+		return
+	}
+
+	s.errorHandler(&ParseError{
+		Err:       err,
+		Raw:       append([]byte(nil), line...),
+		Client:    client,
+		Listener:  src.name(),
+		Transport: src.transport,
+		Offset:    offset,
+	})
+}
+
+func (s *Server) reportTransportError(err error, op string, client string, src *source) {
+	if s.transportErrorHandler == nil {
+		return
+	}
+
+	s.transportErrorHandler(&TransportError{
+		Err:       err,
+		Op:        op,
+		Client:    client,
+		Listener:  src.name(),
+		Transport: src.transport,
+	})
+}
+
+// Waits a bit after a temporary error, to avoid a busy loop
+func backoffTemporary() {
+	time.Sleep(10 * time.Millisecond)
+}
@@ -0,0 +1,108 @@
+package syslog
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+type ErrorsSuite struct{}
+
+var _ = Suite(&ErrorsSuite{})
+
+type errorRecorder struct {
+	mutex           sync.Mutex
+	parseErrors     []*ParseError
+	transportErrors []*TransportError
+}
+
+func (r *errorRecorder) parseError(err *ParseError) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.parseErrors = append(r.parseErrors, err)
+}
+
+func (r *errorRecorder) transportError(err *TransportError) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.transportErrors = append(r.transportErrors, err)
+}
+
+func (s *ErrorsSuite) TestParseError(c *C) {
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(new(HandlerMock))
+	server.SetErrorHandler(recorder.parseError)
+	server.goParseDatagrams()
+	src := server.metrics.get("127.0.0.1:514", "udp")
+	server.datagramChannel <- DatagramMessage{message: []byte("<34>1 2003-13-11T22:14:15.003Z host"), client: "10.0.0.1:1234", source: src}
+	close(server.datagramChannel)
+	server.Wait()
+
+	c.Assert(recorder.parseErrors, HasLen, 1)
+	err := recorder.parseErrors[0]
+	c.Check(err.Err, NotNil)
+	c.Check(string(err.Raw), Equals, "<34>1 2003-13-11T22:14:15.003Z host")
+	c.Check(err.Client, Equals, "10.0.0.1:1234")
+	c.Check(err.Listener, Equals, "127.0.0.1:514")
+	c.Check(err.Transport, Equals, "udp")
+	c.Check(err.Offset, Equals, 13)
+	c.Check(server.GetLastError(), Equals, err.Err)
+	c.Check(errors.Is(err, format.ErrMonthInvalid), Equals, true)
+
+	var fieldErr *format.FieldError
+	c.Assert(errors.As(err, &fieldErr), Equals, true)
+	c.Check(fieldErr.Field, Equals, format.FieldTimestamp)
+	c.Check(fieldErr.Offset, Equals, 13)
+}
+
+func (s *ErrorsSuite) TestHandshakeError(c *C) {
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(new(HandlerMock))
+	server.SetTransportErrorHandler(recorder.transportError)
+	c.Assert(server.ListenTCPTLS("127.0.0.1:0", getServerConfig()), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	conn, err := net.Dial("tcp", server.listeners[0].Addr().String())
+	c.Assert(err, IsNil)
+	conn.Write([]byte(exampleRFC5424Syslog + "\n"))
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpHandshake)
+	c.Check(recorder.transportErrors[0].Transport, Equals, "tls")
+	c.Check(recorder.transportErrors[0].Client, Equals, conn.LocalAddr().String())
+}
+
+func (s *ErrorsSuite) TestReadTimeoutError(c *C) {
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(new(HandlerMock))
+	server.SetTimeout(20)
+	server.SetTransportErrorHandler(recorder.transportError)
+	c.Assert(server.ListenTCP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	conn, err := net.Dial("tcp", server.listeners[0].Addr().String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpRead)
+	c.Check(recorder.transportErrors[0].Transport, Equals, "tcp")
+	c.Check(recorder.transportErrors[0].Err.(net.Error).Timeout(), Equals, true)
+}
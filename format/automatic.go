@@ -21,7 +21,15 @@ import (
  * format, it would be best to select it explicitly.
  */
 
-type Automatic struct{}
+type Automatic struct {
+	// Applies to the RFC5424 messages, as RFC5424.Strict
+	Strict bool
+	// Applies to the RFC3164 messages, as RFC3164.Layouts
+	Layouts []string
+
+	rfc3164Parsers parserPool
+	rfc5424Parsers parserPool
+}
 
 const (
 	detectedUnknown = iota
@@ -65,9 +73,14 @@ func detect(data []byte) int {
 func (f *Automatic) GetParser(line []byte) LogParser {
 	switch format := detect(line); format {
 	case detectedRFC3164:
-		return &parserWrapper{rfc3164.NewParser(line)}
+		return f.getRFC3164Parser(line)
 	case detectedRFC5424:
-		return &parserWrapper{rfc5424.NewParser(line)}
+		// The pooled parsers may come from before the settings were changed
+		if w := f.rfc5424Parsers.get(line); w != nil {
+			w.LogParser.(*rfc5424.Parser).Strict(f.Strict)
+			return w
+		}
+		return &parserWrapper{newRFC5424Parser(line, f.Strict)}
 	default:
 		// If the line was an RFC6587 line, the splitter should already have removed the length,
 		// so one of the above two will be chosen if the line is correctly formed. However, it
@@ -75,7 +88,30 @@ func (f *Automatic) GetParser(line []byte) LogParser {
 		// will return detectedRFC6587. The line may also simply be malformed after the length in
 		// which case we will have detectedUnknown. In this case we return the simplest parser so
 		// the illegally formatted line is properly handled
-		return &parserWrapper{rfc3164.NewParser(line)}
+		return f.getRFC3164Parser(line)
+	}
+}
+
+func (f *Automatic) getRFC3164Parser(line []byte) LogParser {
+	if w := f.rfc3164Parsers.get(line); w != nil {
+		w.LogParser.(*rfc3164.Parser).Layouts(f.Layouts)
+		return w
+	}
+
+	return &parserWrapper{newRFC3164Parser(line, f.Layouts)}
+}
+
+func (f *Automatic) PutParser(parser LogParser) {
+	w, ok := parser.(*parserWrapper)
+	if !ok {
+		return
+	}
+
+	switch w.LogParser.(type) {
+	case *rfc3164.Parser:
+		f.rfc3164Parsers.put(w)
+	case *rfc5424.Parser:
+		f.rfc5424Parsers.put(w)
 	}
 }
 
@@ -0,0 +1,61 @@
+package format
+
+import (
+	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser"
+	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser/rfc5424"
+)
+
+// The error of a parser, locating where the message failed. Match it against
+// the errors below with errors.Is
+type FieldError = syslogparser.FieldError
+
+// Fields of FieldError
+const (
+	FieldPriority       = syslogparser.FieldPriority
+	FieldVersion        = syslogparser.FieldVersion
+	FieldTimestamp      = syslogparser.FieldTimestamp
+	FieldHostname       = syslogparser.FieldHostname
+	FieldTag            = syslogparser.FieldTag
+	FieldAppName        = syslogparser.FieldAppName
+	FieldProcId         = syslogparser.FieldProcId
+	FieldMsgId          = syslogparser.FieldMsgId
+	FieldStructuredData = syslogparser.FieldStructuredData
+	FieldContent        = syslogparser.FieldContent
+)
+
+// Errors of both parsers
+var (
+	ErrEOL                    = syslogparser.ErrEOL
+	ErrNoSpace                = syslogparser.ErrNoSpace
+	ErrPriorityNoStart        = syslogparser.ErrPriorityNoStart
+	ErrPriorityEmpty          = syslogparser.ErrPriorityEmpty
+	ErrPriorityNoEnd          = syslogparser.ErrPriorityNoEnd
+	ErrPriorityTooShort       = syslogparser.ErrPriorityTooShort
+	ErrPriorityTooLong        = syslogparser.ErrPriorityTooLong
+	ErrPriorityNonDigit       = syslogparser.ErrPriorityNonDigit
+	ErrVersionNotFound        = syslogparser.ErrVersionNotFound
+	ErrTimestampUnknownFormat = syslogparser.ErrTimestampUnknownFormat
+	ErrHostnameTooShort       = syslogparser.ErrHostnameTooShort
+)
+
+// Errors of the RFC5424 parser
+var (
+	ErrYearInvalid       = rfc5424.ErrYearInvalid
+	ErrMonthInvalid      = rfc5424.ErrMonthInvalid
+	ErrDayInvalid        = rfc5424.ErrDayInvalid
+	ErrHourInvalid       = rfc5424.ErrHourInvalid
+	ErrMinuteInvalid     = rfc5424.ErrMinuteInvalid
+	ErrSecondInvalid     = rfc5424.ErrSecondInvalid
+	ErrSecFracInvalid    = rfc5424.ErrSecFracInvalid
+	ErrTimeZoneInvalid   = rfc5424.ErrTimeZoneInvalid
+	ErrInvalidTimeFormat = rfc5424.ErrInvalidTimeFormat
+	ErrInvalidAppName    = rfc5424.ErrInvalidAppName
+	ErrInvalidProcId     = rfc5424.ErrInvalidProcId
+	ErrInvalidMsgId      = rfc5424.ErrInvalidMsgId
+	ErrNoStructuredData  = rfc5424.ErrNoStructuredData
+	ErrInvalidSDName     = rfc5424.ErrInvalidSDName
+	ErrInvalidSDParam    = rfc5424.ErrInvalidSDParam
+	ErrInvalidPriority   = rfc5424.ErrInvalidPriority
+	ErrInvalidVersion    = rfc5424.ErrInvalidVersion
+	ErrInvalidHostname   = rfc5424.ErrInvalidHostname
+)
@@ -2,6 +2,7 @@ package format
 
 import (
 	"bufio"
+	"sync"
 	"time"
 
 	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser"
@@ -9,17 +10,34 @@ import (
 
 type LogParts map[string]interface{}
 
+// The RFC5424 STRUCTURED-DATA, as found in the "structured_data_elements" key
+type SDElement = syslogparser.SDElement
+type SDParam = syslogparser.SDParam
+
 type LogParser interface {
 	Parse() error
 	Dump() LogParts
 	Location(*time.Location)
 }
 
+// Implemented by the parsers able to tell where they stopped, so the byte
+// offset of a parse error can be reported
+type OffsetParser interface {
+	Offset() int
+}
+
 type Format interface {
 	GetParser([]byte) LogParser
 	GetSplitFunc() bufio.SplitFunc
 }
 
+// Implemented by the formats which reuse their parsers: a parser given back
+// once dumped is reset and returned again by GetParser, so it must not be used
+// afterwards
+type ParserPool interface {
+	PutParser(LogParser)
+}
+
 type parserWrapper struct {
 	syslogparser.LogParser
 }
@@ -27,3 +45,35 @@ type parserWrapper struct {
 func (w *parserWrapper) Dump() LogParts {
 	return LogParts(w.LogParser.Dump())
 }
+
+func (w *parserWrapper) Offset() int {
+	if p, ok := w.LogParser.(OffsetParser); ok {
+		return p.Offset()
+	}
+
+	return -1
+}
+
+func (w *parserWrapper) Reset(line []byte) {
+	w.LogParser.(interface{ Reset([]byte) }).Reset(line)
+}
+
+// The parsers given back to a format, reset for the next message
+type parserPool struct {
+	pool sync.Pool
+}
+
+// Returns a parser of the pool reset for line, nil if the pool is empty
+func (p *parserPool) get(line []byte) *parserWrapper {
+	w, ok := p.pool.Get().(*parserWrapper)
+	if !ok {
+		return nil
+	}
+
+	w.Reset(line)
+	return w
+}
+
+func (p *parserPool) put(w *parserWrapper) {
+	p.pool.Put(w)
+}
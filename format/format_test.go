@@ -11,3 +11,74 @@ func Test(t *testing.T) { TestingT(t) }
 type FormatSuite struct{}
 
 var _ = Suite(&FormatSuite{})
+
+func (s *FormatSuite) TestParserPool(c *C) {
+	rfc3164 := []byte(`<13>May  1 20:51:40 myhostname myprogram[42]: ciao`)
+	rfc5424 := []byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3"] An application event log entry...`)
+
+	for _, t := range []struct {
+		format Format
+		lines  [][]byte
+	}{
+		{&RFC3164{}, [][]byte{rfc3164, []byte("<13>hello")}},
+		{&RFC5424{}, [][]byte{rfc5424, []byte("<34>1 2003-02-30T22:14:15.003Z host su - ID47 - msg")}},
+		{&RFC6587{}, [][]byte{rfc5424, []byte("<34>1 2003-02-30T22:14:15.003Z host su - ID47 - msg")}},
+		{&Automatic{}, [][]byte{rfc3164, rfc5424, rfc3164}},
+	} {
+		for i := 0; i < 3; i++ {
+			for _, line := range t.lines {
+				expected := t.format.GetParser(line)
+				expected.Parse()
+
+				parser := t.format.GetParser(line)
+				c.Check(parser.Parse(), IsNil)
+				logParts := parser.Dump()
+				t.format.(ParserPool).PutParser(parser)
+
+				delete(logParts, "timestamp")
+				expectedParts := expected.Dump()
+				delete(expectedParts, "timestamp")
+				c.Check(logParts, DeepEquals, expectedParts, Commentf("%s", line))
+			}
+		}
+	}
+}
+
+func (s *FormatSuite) TestParserPool_Settings(c *C) {
+	rfc3164 := []byte(`<13>2018.01.12 20:51:40 myhostname myprogram[42]: ciao`)
+	rfc5424 := []byte(`<34>1 2003-02-30T22:14:15.003Z host su - ID47 - msg`)
+
+	rfc3164Format, rfc5424Format, rfc6587Format, automatic := &RFC3164{}, &RFC5424{}, &RFC6587{}, &Automatic{}
+	for _, t := range []struct {
+		format Format
+		line   []byte
+		change func()
+		check  func(parser LogParser)
+	}{
+		{rfc3164Format, rfc3164, func() { rfc3164Format.Layouts = []string{"2006.01.02 15:04:05"} }, func(parser LogParser) {
+			c.Check(parser.Parse(), IsNil)
+			c.Check(parser.Dump()["hostname"], Equals, "myhostname")
+		}},
+		{automatic, rfc3164, func() { automatic.Layouts = []string{"2006.01.02 15:04:05"} }, func(parser LogParser) {
+			c.Check(parser.Parse(), IsNil)
+			c.Check(parser.Dump()["hostname"], Equals, "myhostname")
+		}},
+		{rfc5424Format, rfc5424, func() { rfc5424Format.Strict = true }, func(parser LogParser) {
+			c.Check(parser.Parse(), NotNil)
+		}},
+		{rfc6587Format, rfc5424, func() { rfc6587Format.Strict = true }, func(parser LogParser) {
+			c.Check(parser.Parse(), NotNil)
+		}},
+		{automatic, rfc5424, func() { automatic.Strict = true }, func(parser LogParser) {
+			c.Check(parser.Parse(), NotNil)
+		}},
+	} {
+		// The parser pooled before the change follows the new settings
+		parser := t.format.GetParser(t.line)
+		parser.Parse()
+		t.format.(ParserPool).PutParser(parser)
+
+		t.change()
+		t.check(t.format.GetParser(t.line))
+	}
+}
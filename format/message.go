@@ -0,0 +1,170 @@
+package format
+
+import (
+	"time"
+
+	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser"
+)
+
+// Version of the RFC3164 messages, which do not carry one
+const NoVersion = syslogparser.NO_VERSION
+
+// Message is the typed counterpart of LogParts. The RFC3164 tag, process ID
+// and content are stored as AppName, ProcID and Message, any key without a
+// field ends at Extra so the conversion back to LogParts does not lose
+// anything. Raw is the message as handed to the parser, without the framing
+// and the trailing control characters of a datagram, see
+// Server.SetIncludeMetadata.
+type Message struct {
+	Priority          int
+	Facility          int
+	Severity          int
+	Version           int
+	Timestamp         time.Time
+	Hostname          string
+	AppName           string
+	ProcID            string
+	MsgID             string
+	StructuredData    []SDElement
+	RawStructuredData string
+	Message           string
+	Client            string
+	TLSPeer           string
+	Raw               []byte
+	ReceivedAt        time.Time
+	Transport         string
+	LocalAddr         string
+	Listener          string
+	Truncated         bool
+	RateLimited       bool
+	Warnings          []string
+	Extra             LogParts
+}
+
+// NewMessage builds a Message from the LogParts given by the parsers
+func NewMessage(logParts LogParts) *Message {
+	m := &Message{Version: NoVersion}
+
+	for key, value := range logParts {
+		if !m.set(key, value) {
+			if m.Extra == nil {
+				m.Extra = make(LogParts)
+			}
+			m.Extra[key] = value
+		}
+	}
+
+	return m
+}
+
+func (m *Message) set(key string, value interface{}) bool {
+	var ok bool
+
+	switch key {
+	case "priority":
+		m.Priority, ok = value.(int)
+	case "facility":
+		m.Facility, ok = value.(int)
+	case "severity":
+		m.Severity, ok = value.(int)
+	case "version":
+		m.Version, ok = value.(int)
+	case "timestamp":
+		m.Timestamp, ok = value.(time.Time)
+	case "hostname":
+		m.Hostname, ok = value.(string)
+	case "app_name", "tag":
+		m.AppName, ok = value.(string)
+	case "proc_id":
+		m.ProcID, ok = value.(string)
+	case "msg_id":
+		m.MsgID, ok = value.(string)
+	case "structured_data":
+		m.RawStructuredData, ok = value.(string)
+	case "structured_data_elements":
+		m.StructuredData, ok = value.([]SDElement)
+	case "message", "content":
+		m.Message, ok = value.(string)
+	case "client":
+		m.Client, ok = value.(string)
+	case "tls_peer":
+		m.TLSPeer, ok = value.(string)
+	case "raw":
+		m.Raw, ok = value.([]byte)
+	case "received_at":
+		m.ReceivedAt, ok = value.(time.Time)
+	case "transport":
+		m.Transport, ok = value.(string)
+	case "local_addr":
+		m.LocalAddr, ok = value.(string)
+	case "listener":
+		m.Listener, ok = value.(string)
+	case "truncated":
+		m.Truncated, ok = value.(bool)
+	case "rate_limited":
+		m.RateLimited, ok = value.(bool)
+	case "warnings":
+		m.Warnings, ok = value.([]string)
+	}
+
+	return ok
+}
+
+// LogParts returns the Message using the keys of its format, RFC3164 when it
+// has no version and RFC5424 otherwise
+func (m *Message) LogParts() LogParts {
+	logParts := LogParts{
+		"priority":  m.Priority,
+		"facility":  m.Facility,
+		"severity":  m.Severity,
+		"timestamp": m.Timestamp,
+		"hostname":  m.Hostname,
+		"client":    m.Client,
+		"tls_peer":  m.TLSPeer,
+	}
+
+	if m.Version == NoVersion {
+		logParts["tag"] = m.AppName
+		logParts["app_name"] = m.AppName
+		logParts["proc_id"] = m.ProcID
+		logParts["content"] = m.Message
+	} else {
+		logParts["version"] = m.Version
+		logParts["app_name"] = m.AppName
+		logParts["proc_id"] = m.ProcID
+		logParts["msg_id"] = m.MsgID
+		logParts["structured_data"] = m.RawStructuredData
+		logParts["structured_data_elements"] = m.StructuredData
+		logParts["message"] = m.Message
+	}
+
+	// The receive metadata is optional, so only set when present
+	if m.Raw != nil {
+		logParts["raw"] = m.Raw
+	}
+
+	if !m.ReceivedAt.IsZero() {
+		logParts["received_at"] = m.ReceivedAt
+		logParts["transport"] = m.Transport
+		logParts["local_addr"] = m.LocalAddr
+		logParts["listener"] = m.Listener
+	}
+
+	if m.Truncated {
+		logParts["truncated"] = true
+	}
+
+	if m.RateLimited {
+		logParts["rate_limited"] = true
+	}
+
+	if len(m.Warnings) > 0 {
+		logParts["warnings"] = m.Warnings
+	}
+
+	for key, value := range m.Extra {
+		logParts[key] = value
+	}
+
+	return logParts
+}
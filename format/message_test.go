@@ -0,0 +1,73 @@
+package format
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *FormatSuite) TestMessage_RFC3164(c *C) {
+	f := RFC3164{}
+
+	parser := f.GetParser([]byte(`<13>May  1 20:51:40 myhostname myprogram[42]: ciao`))
+	c.Assert(parser.Parse(), IsNil)
+	logParts := parser.Dump()
+	logParts["client"] = "127.0.0.1:514"
+	logParts["tls_peer"] = ""
+
+	m := NewMessage(logParts)
+	c.Assert(m.Priority, Equals, 13)
+	c.Assert(m.Facility, Equals, 1)
+	c.Assert(m.Severity, Equals, 5)
+	c.Assert(m.Version, Equals, NoVersion)
+	c.Assert(m.Timestamp.Month(), Equals, time.May)
+	c.Assert(m.Hostname, Equals, "myhostname")
+	c.Assert(m.AppName, Equals, "myprogram")
+	c.Assert(m.ProcID, Equals, "42")
+	c.Assert(m.Message, Equals, "ciao")
+	c.Assert(m.Client, Equals, "127.0.0.1:514")
+	c.Assert(m.Extra, IsNil)
+
+	c.Assert(m.LogParts(), DeepEquals, logParts)
+}
+
+func (s *FormatSuite) TestMessage_RFC5424(c *C) {
+	f := RFC5424{}
+
+	parser := f.GetParser([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 8710 ID47 [exampleSDID@32473 iut="3"] An application event log entry...`))
+	c.Assert(parser.Parse(), IsNil)
+	logParts := parser.Dump()
+	logParts["client"] = "127.0.0.1:514"
+	logParts["tls_peer"] = "peer"
+	logParts["raw"] = []byte("raw")
+
+	m := NewMessage(logParts)
+	c.Assert(m.Priority, Equals, 165)
+	c.Assert(m.Version, Equals, 1)
+	c.Assert(m.Timestamp, Equals, time.Date(2003, time.October, 11, 22, 14, 15, 3*10e5, time.UTC))
+	c.Assert(m.AppName, Equals, "evntslog")
+	c.Assert(m.ProcID, Equals, "8710")
+	c.Assert(m.MsgID, Equals, "ID47")
+	c.Assert(m.RawStructuredData, Equals, `[exampleSDID@32473 iut="3"]`)
+	c.Assert(m.StructuredData, DeepEquals, []SDElement{{ID: "exampleSDID@32473", Params: []SDParam{{Name: "iut", Value: "3"}}}})
+	c.Assert(m.Message, Equals, "An application event log entry...")
+	c.Assert(m.TLSPeer, Equals, "peer")
+	c.Assert(m.Raw, DeepEquals, []byte("raw"))
+
+	c.Assert(m.LogParts(), DeepEquals, logParts)
+}
+
+func (s *FormatSuite) TestMessage_Extra(c *C) {
+	logParts := LogParts{
+		"priority": 13,
+		"hostname": 42,
+		"custom":   "value",
+	}
+
+	m := NewMessage(logParts)
+	c.Assert(m.Priority, Equals, 13)
+	c.Assert(m.Hostname, Equals, "")
+	c.Assert(m.Extra, DeepEquals, LogParts{"hostname": 42, "custom": "value"})
+	c.Assert(m.LogParts()["hostname"], Equals, 42)
+	c.Assert(m.LogParts()["custom"], Equals, "value")
+}
@@ -6,10 +6,38 @@ import (
 	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser/rfc3164"
 )
 
-type RFC3164 struct{}
+// The timestamp layouts tried when RFC3164.Layouts is nil
+var RFC3164Layouts = rfc3164.DefaultLayouts
+
+// Layouts are the layouts of time.Parse tried in order on the timestamp, each
+// on as many space separated fields as it has, RFC3164Layouts when nil
+type RFC3164 struct {
+	Layouts []string
+
+	parsers parserPool
+}
 
 func (f *RFC3164) GetParser(line []byte) LogParser {
-	return &parserWrapper{rfc3164.NewParser(line)}
+	// The pooled parsers may come from before Layouts was changed
+	if w := f.parsers.get(line); w != nil {
+		w.LogParser.(*rfc3164.Parser).Layouts(f.Layouts)
+		return w
+	}
+
+	return &parserWrapper{newRFC3164Parser(line, f.Layouts)}
+}
+
+func newRFC3164Parser(line []byte, layouts []string) *rfc3164.Parser {
+	p := rfc3164.NewParser(line)
+	p.Layouts(layouts)
+
+	return p
+}
+
+func (f *RFC3164) PutParser(parser LogParser) {
+	if w, ok := parser.(*parserWrapper); ok {
+		f.parsers.put(w)
+	}
 }
 
 func (f *RFC3164) GetSplitFunc() bufio.SplitFunc {
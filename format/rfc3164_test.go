@@ -1,6 +1,8 @@
 package format
 
 import (
+	"time"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -31,6 +33,8 @@ func (s *FormatSuite) TestRFC3164_CorrectParsingTypicalWithPID(c *C) {
 	c.Assert(parser.Dump()["content"], Equals, "ciao")
 	c.Assert(parser.Dump()["hostname"], Equals, "myhostname")
 	c.Assert(parser.Dump()["tag"], Equals, "myprogram")
+	c.Assert(parser.Dump()["app_name"], Equals, "myprogram")
+	c.Assert(parser.Dump()["proc_id"], Equals, "42")
 
 }
 
@@ -62,3 +66,18 @@ func (s *FormatSuite) TestRFC3164_CorrectParsingJournald(c *C) {
 	c.Assert(parser.Dump()["tag"], Equals, "myprog")
 
 }
+
+func (s *FormatSuite) TestRFC3164_Layouts(c *C) {
+	find := `<13>2018.01.12 20:51:40 myhostname myprogram[42]: ciao`
+
+	for _, f := range []Format{
+		&RFC3164{Layouts: append(RFC3164Layouts, "2006.01.02 15:04:05")},
+		&Automatic{Layouts: []string{"2006.01.02 15:04:05"}},
+	} {
+		parser := f.GetParser([]byte(find))
+		c.Assert(parser.Parse(), IsNil)
+		c.Assert(parser.Dump()["timestamp"], Equals, time.Date(2018, time.January, 12, 20, 51, 40, 0, time.UTC))
+		c.Assert(parser.Dump()["hostname"], Equals, "myhostname")
+		c.Assert(parser.Dump()["tag"], Equals, "myprogram")
+	}
+}
@@ -6,10 +6,36 @@ import (
 	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser/rfc5424"
 )
 
-type RFC5424 struct{}
+// When Strict is set any deviation from the RFC fails the parsing, otherwise
+// the parser recovers from the ones it can and lists them in the "warnings"
+// key of the message
+type RFC5424 struct {
+	Strict bool
+
+	parsers parserPool
+}
 
 func (f *RFC5424) GetParser(line []byte) LogParser {
-	return &parserWrapper{rfc5424.NewParser(line)}
+	// The pooled parsers may come from before Strict was changed
+	if w := f.parsers.get(line); w != nil {
+		w.LogParser.(*rfc5424.Parser).Strict(f.Strict)
+		return w
+	}
+
+	return &parserWrapper{newRFC5424Parser(line, f.Strict)}
+}
+
+func (f *RFC5424) PutParser(parser LogParser) {
+	if w, ok := parser.(*parserWrapper); ok {
+		f.parsers.put(w)
+	}
+}
+
+func newRFC5424Parser(line []byte, strict bool) *rfc5424.Parser {
+	p := rfc5424.NewParser(line)
+	p.Strict(strict)
+
+	return p
 }
 
 func (f *RFC5424) GetSplitFunc() bufio.SplitFunc {
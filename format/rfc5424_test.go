@@ -8,3 +8,31 @@ func (s *FormatSuite) TestRFC5424_SingleSplit(c *C) {
 	f := RFC5424{}
 	c.Assert(f.GetSplitFunc(), IsNil)
 }
+
+func (s *FormatSuite) TestRFC5424_StructuredDataElements(c *C) {
+	f := RFC5424{}
+
+	find := `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App\]lication"] An application event log entry...`
+	parser := f.GetParser([]byte(find))
+	err := parser.Parse()
+	c.Assert(err, IsNil)
+	c.Assert(parser.Dump()["structured_data"], Equals, `[exampleSDID@32473 iut="3" eventSource="App\]lication"]`)
+	c.Assert(parser.Dump()["structured_data_elements"], DeepEquals, []SDElement{
+		{ID: "exampleSDID@32473", Params: []SDParam{{Name: "iut", Value: "3"}, {Name: "eventSource", Value: "App]lication"}}},
+	})
+	c.Assert(parser.Dump()["message"], Equals, "An application event log entry...")
+}
+
+func (s *FormatSuite) TestRFC5424_Strict(c *C) {
+	find := `<34>1 2003-02-30T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed`
+
+	strict := RFC5424{Strict: true}
+	c.Assert(strict.GetParser([]byte(find)).Parse(), NotNil)
+
+	lenient := RFC5424{}
+	parser := lenient.GetParser([]byte(find))
+	c.Assert(parser.Parse(), IsNil)
+	m := NewMessage(parser.Dump())
+	c.Assert(m.Warnings, DeepEquals, []string{"Invalid day in timestamp"})
+	c.Assert(m.LogParts()["warnings"], DeepEquals, m.Warnings)
+}
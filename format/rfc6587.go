@@ -8,10 +8,26 @@ import (
 	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser/rfc5424"
 )
 
-type RFC6587 struct{}
+// The messages are parsed as RFC5424 ones, Strict is that of RFC5424
+type RFC6587 struct {
+	Strict bool
+
+	parsers parserPool
+}
 
 func (f *RFC6587) GetParser(line []byte) LogParser {
-	return &parserWrapper{rfc5424.NewParser(line)}
+	if w := f.parsers.get(line); w != nil {
+		w.LogParser.(*rfc5424.Parser).Strict(f.Strict)
+		return w
+	}
+
+	return &parserWrapper{newRFC5424Parser(line, f.Strict)}
+}
+
+func (f *RFC6587) PutParser(parser LogParser) {
+	if w, ok := parser.(*parserWrapper); ok {
+		f.parsers.put(w)
+	}
 }
 
 func (f *RFC6587) GetSplitFunc() bufio.SplitFunc {
@@ -0,0 +1,254 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// What happens to a TCP/TLS frame bigger than the maximum message size
+type OversizePolicy int
+
+const (
+	// The connection is closed, this is the default
+	OversizeClose OversizePolicy = iota
+	// The first bytes of the frame are delivered with logParts["truncated"]
+	// set to true, the rest of the frame is discarded
+	OversizeTruncate
+	// The frame is discarded and the connection keeps going
+	OversizeSkip
+)
+
+const (
+	defaultMaxMessageSize = 64 * 1024
+	// Room left in the scanner buffer for the octet counting prefix
+	maxOctetPrefixSize = 16
+)
+
+// Reported, with OpFrame, for every frame over the maximum message size
+var ErrFrameTooLarge = errors.New("frame exceeds the maximum message size")
+
+//Sets the maximum size of a TCP/TLS frame and what to do with the bigger ones,
+//the default is 64KiB and closing the connection
+func (s *Server) SetMaxMessageSize(size int, policy OversizePolicy) {
+	s.maxMessageSize = size
+	s.oversizePolicy = policy
+}
+
+// Wraps the split function of a connection, enforcing the maximum frame size.
+// Frames are either octet counted, whose length is known from the prefix, or
+// delimited by a new line.
+type frameLimiter struct {
+	split         bufio.SplitFunc
+	max           int
+	policy        OversizePolicy
+	octetCounting bool
+	// Called for every oversized frame
+	report func()
+	// Bytes ending the frames which are not octet counted
+	delimiters string
+
+	// Bytes of an octet counted frame still to be discarded
+	discard int
+	// Discarding up to the next new line
+	discardLine bool
+	// Whether the last token returned was truncated
+	truncated bool
+}
+
+func (s *Server) newFrameLimiter(src *source, report func()) *frameLimiter {
+	split, delimiters := s.format.GetSplitFunc(), "\n"
+	if split == nil {
+		split = bufio.ScanLines
+		if src.transport == "unix" {
+			split, delimiters = scanLinesOrNUL, unixDelimiters
+		}
+	}
+
+	octetCounting := false
+	switch s.format.(type) {
+	case *format.RFC6587, *format.Automatic:
+		octetCounting = true
+	}
+
+	if src.rfc5425 {
+		split = octetCountingSplit
+		octetCounting = true
+	}
+
+	max := s.maxMessageSize
+	if max <= 0 {
+		max = defaultMaxMessageSize
+	}
+
+	// The RELP frames are delivered whole to be acknowledged, so none is
+	// truncated nor skipped
+	policy := s.oversizePolicy
+	if src.relp {
+		split, octetCounting = relpSplit, false
+		max += maxRELPHeaderSize + 1
+		policy = OversizeClose
+	}
+
+	return &frameLimiter{
+		split:         split,
+		max:           max,
+		policy:        policy,
+		octetCounting: octetCounting,
+		report:        report,
+		delimiters:    delimiters,
+	}
+}
+
+// Size of the scanner buffer, big enough for a frame of the maximum size
+func (l *frameLimiter) bufferSize() int {
+	return l.max + maxOctetPrefixSize
+}
+
+func (l *frameLimiter) Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	l.truncated = false
+
+	if l.discard > 0 {
+		n := l.discard
+		if n > len(data) {
+			n = len(data)
+		}
+		l.discard -= n
+		return n, nil, nil
+	}
+
+	if l.discardLine {
+		if i := bytes.IndexAny(data, l.delimiters); i >= 0 {
+			l.discardLine = false
+			return i + 1, nil, nil
+		}
+		return len(data), nil, nil
+	}
+
+	advance, token, err = l.split(data, atEOF)
+	if err != nil {
+		return advance, token, err
+	}
+
+	if token != nil {
+		if len(token) <= l.max {
+			return advance, token, nil
+		}
+
+		// The whole frame is buffered but it is too large
+		return l.oversized(advance, token[:l.max])
+	}
+
+	if advance > 0 {
+		return advance, nil, nil
+	}
+
+	// The split function requests more data
+	if length, prefix, ok := l.octetCount(data); ok {
+		if length <= l.max {
+			return 0, nil, nil
+		}
+
+		if l.policy == OversizeTruncate && len(data) < prefix+l.max {
+			return 0, nil, nil
+		}
+
+		// Only a truncated frame is delivered, the buffer may not hold the
+		// maximum size otherwise
+		end := prefix + l.max
+		var truncated []byte
+		if l.policy == OversizeTruncate {
+			truncated = data[prefix:end]
+		} else {
+			end = prefix + length
+			if end > len(data) {
+				end = len(data)
+			}
+		}
+		l.discard = prefix + length - end
+		return l.oversized(end, truncated)
+	}
+
+	if len(data) <= l.max {
+		return 0, nil, nil
+	}
+
+	if l.policy == OversizeTruncate {
+		l.discardLine = true
+		return l.oversized(l.max, data[:l.max])
+	}
+
+	l.discardLine = true
+	return l.oversized(len(data), nil)
+}
+
+// Applies the policy to an oversized frame, advance is what the frame uses of
+// the buffer and truncated its first bytes
+func (l *frameLimiter) oversized(advance int, truncated []byte) (int, []byte, error) {
+	if l.report != nil {
+		l.report()
+	}
+
+	switch l.policy {
+	case OversizeTruncate:
+		l.truncated = true
+		return advance, truncated, nil
+	case OversizeSkip:
+		return advance, nil, nil
+	default:
+		return 0, nil, ErrFrameTooLarge
+	}
+}
+
+// Splits octet counted frames only, without the fallback of RFC6587 to the
+// non-transparent framing, as RFC5425 requires
+func octetCountingSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, c := range data {
+		if c == ' ' && i > 0 {
+			length, err := strconv.Atoi(string(data[:i]))
+			if err != nil {
+				return 0, nil, ErrNotOctetCounted
+			}
+
+			end := i + 1 + length
+			if len(data) >= end {
+				return end, data[i+1 : end], nil
+			}
+			return 0, nil, nil
+		}
+
+		if c < '0' || c > '9' || (i == 0 && c == '0') || i >= maxOctetPrefixSize {
+			return 0, nil, ErrNotOctetCounted
+		}
+	}
+
+	return 0, nil, nil
+}
+
+// Reads the octet counting prefix, the frame length followed by a space
+func (l *frameLimiter) octetCount(data []byte) (length int, prefix int, ok bool) {
+	if !l.octetCounting {
+		return 0, 0, false
+	}
+
+	for i, c := range data {
+		if i >= maxOctetPrefixSize {
+			return 0, 0, false
+		}
+
+		if c == ' ' && i > 0 {
+			return length, i + 1, true
+		}
+
+		if c < '0' || c > '9' {
+			return 0, 0, false
+		}
+
+		length = length*10 + int(c-'0')
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,195 @@
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+type FramingSuite struct{}
+
+var _ = Suite(&FramingSuite{})
+
+type handlerRecorder struct {
+	mutex    sync.Mutex
+	logParts []format.LogParts
+	lengths  []int64
+}
+
+func (s *handlerRecorder) Handle(logParts format.LogParts, msgLen int64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.logParts = append(s.logParts, logParts)
+	s.lengths = append(s.lengths, msgLen)
+}
+
+func octetFrame(message string) string {
+	return fmt.Sprintf("%d %s", len(message), message)
+}
+
+func (s *FramingSuite) scan(f format.Format, size int, policy OversizePolicy, data string) (*handlerRecorder, *errorRecorder, *ConnMock) {
+	handler := new(handlerRecorder)
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(f)
+	server.SetHandler(handler)
+	server.SetTransportErrorHandler(recorder.transportError)
+	server.SetMaxMessageSize(size, policy)
+	con := &ConnMock{ReadData: []byte(data)}
+	server.goScanConnection(con)
+	server.Wait()
+
+	return handler, recorder, con
+}
+
+func (s *FramingSuite) TestTruncateLine(c *C) {
+	long := "<31>Dec 26 05:08:46 hostname tag[296]: " + strings.Repeat("x", 100)
+	handler, recorder, _ := s.scan(RFC3164, 64, OversizeTruncate, long+"\n"+exampleSyslog+"\n")
+
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.lengths[0], Equals, int64(64))
+	c.Check(handler.logParts[0]["truncated"], Equals, true)
+	c.Check(handler.logParts[0]["hostname"], Equals, "hostname")
+	c.Check(handler.logParts[1]["truncated"], IsNil)
+	c.Check(handler.logParts[1]["content"], Equals, "content")
+
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpFrame)
+	c.Check(recorder.transportErrors[0].Err, Equals, ErrFrameTooLarge)
+}
+
+func (s *FramingSuite) TestSkipLine(c *C) {
+	long := "<31>Dec 26 05:08:46 hostname tag[296]: " + strings.Repeat("x", 300)
+	handler, recorder, _ := s.scan(RFC3164, 64, OversizeSkip, long+"\n"+exampleSyslog+"\n")
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.logParts[0]["content"], Equals, "content")
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpFrame)
+}
+
+func (s *FramingSuite) TestCloseLine(c *C) {
+	long := "<31>Dec 26 05:08:46 hostname tag[296]: " + strings.Repeat("x", 300)
+	handler, recorder, con := s.scan(RFC3164, 64, OversizeClose, exampleSyslog+"\n"+long+"\n"+exampleSyslog+"\n")
+
+	c.Check(handler.logParts, HasLen, 1)
+	c.Check(con.isClosed, Equals, true)
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpFrame)
+}
+
+func (s *FramingSuite) TestTruncateOctetCounted(c *C) {
+	long := exampleRFC5424Syslog + strings.Repeat("x", 300)
+	handler, recorder, _ := s.scan(RFC6587, 128, OversizeTruncate, octetFrame(long)+octetFrame(exampleRFC5424Syslog))
+
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.lengths[0], Equals, int64(128))
+	c.Check(handler.logParts[0]["truncated"], Equals, true)
+	c.Check(handler.logParts[0]["hostname"], Equals, "mymachine.example.com")
+	c.Check(handler.lengths[1], Equals, int64(len(exampleRFC5424Syslog)))
+	c.Check(handler.logParts[1]["message"], Equals, "'su root' failed for lonvick on /dev/pts/8")
+	c.Check(recorder.transportErrors, HasLen, 1)
+}
+
+func (s *FramingSuite) TestSkipOctetCounted(c *C) {
+	long := exampleRFC5424Syslog + strings.Repeat("x\n", 200)
+	handler, recorder, _ := s.scan(RFC6587, 128, OversizeSkip, octetFrame(long)+octetFrame(exampleRFC5424Syslog))
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.lengths[0], Equals, int64(len(exampleRFC5424Syslog)))
+	c.Check(recorder.transportErrors, HasLen, 1)
+}
+
+func (s *FramingSuite) TestSkipBufferedOctetCounted(c *C) {
+	// The whole oversized frame fits in the scanner buffer
+	long := exampleRFC5424Syslog + strings.Repeat("x", 8)
+	handler, recorder, _ := s.scan(Automatic, len(long)-1, OversizeSkip, octetFrame(long)+octetFrame(exampleRFC5424Syslog))
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.lengths[0], Equals, int64(len(exampleRFC5424Syslog)))
+	c.Check(recorder.transportErrors, HasLen, 1)
+}
+
+func (s *FramingSuite) TestCloseOctetCounted(c *C) {
+	long := exampleRFC5424Syslog + strings.Repeat("x", 300)
+	handler, recorder, con := s.scan(RFC6587, 128, OversizeClose, octetFrame(long)+octetFrame(exampleRFC5424Syslog))
+
+	c.Check(handler.logParts, HasLen, 0)
+	c.Check(con.isClosed, Equals, true)
+	c.Check(recorder.transportErrors, HasLen, 1)
+}
+
+func (s *FramingSuite) TestWithinLimit(c *C) {
+	handler, recorder, _ := s.scan(RFC6587, len(exampleRFC5424Syslog), OversizeClose, octetFrame(exampleRFC5424Syslog)+octetFrame(exampleRFC5424Syslog))
+
+	c.Check(handler.logParts, HasLen, 2)
+	c.Check(recorder.transportErrors, HasLen, 0)
+}
+
+// Sends an octet counted frame over the default maximum size, then one within,
+// through a TCP listener
+func (s *FramingSuite) listen(c *C, policy OversizePolicy) (*Server, *handlerRecorder, *errorRecorder, net.Conn) {
+	handler := new(handlerRecorder)
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC6587)
+	server.SetHandler(handler)
+	server.SetTransportErrorHandler(recorder.transportError)
+	server.SetMaxMessageSize(defaultMaxMessageSize, policy)
+	c.Assert(server.ListenTCP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	conn := dial(c, server)
+	long := exampleRFC5424Syslog + strings.Repeat("x", defaultMaxMessageSize)
+	_, err := conn.Write([]byte(octetFrame(long) + octetFrame(exampleRFC5424Syslog)))
+	c.Assert(err, IsNil)
+	time.Sleep(100 * time.Millisecond)
+
+	return server, handler, recorder, conn
+}
+
+func (s *FramingSuite) TestCloseOverDefaultMax(c *C) {
+	server, handler, recorder, conn := s.listen(c, OversizeClose)
+	defer conn.Close()
+
+	// Closed or reset, as the rest of the frame is left unread
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	c.Assert(err, NotNil)
+	netErr, ok := err.(net.Error)
+	c.Check(ok && netErr.Timeout(), Equals, false)
+	server.Kill()
+	server.Wait()
+	c.Check(handler.logParts, HasLen, 0)
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Err, Equals, ErrFrameTooLarge)
+}
+
+func (s *FramingSuite) TestSkipOverDefaultMax(c *C) {
+	server, handler, recorder, conn := s.listen(c, OversizeSkip)
+	conn.Close()
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.lengths[0], Equals, int64(len(exampleRFC5424Syslog)))
+	c.Check(recorder.transportErrors, HasLen, 1)
+}
+
+func (s *FramingSuite) TestTruncateOverDefaultMax(c *C) {
+	server, handler, recorder, conn := s.listen(c, OversizeTruncate)
+	conn.Close()
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.lengths[0], Equals, int64(defaultMaxMessageSize))
+	c.Check(handler.logParts[0]["truncated"], Equals, true)
+	c.Check(handler.lengths[1], Equals, int64(len(exampleRFC5424Syslog)))
+	c.Check(recorder.transportErrors, HasLen, 1)
+}
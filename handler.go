@@ -9,6 +9,11 @@ type Handler interface {
 	Handle(format.LogParts, int64, error)
 }
 
+//The TypedHandler receive every syslog entry as a Message at HandleMessage method
+type TypedHandler interface {
+	HandleMessage(*format.Message, int64, error)
+}
+
 type LogPartsChannel chan format.LogParts
 
 //The ChannelHandler will send all the syslog entries into the given channel
@@ -1,13 +1,29 @@
 package rfc3164
 
 import (
-	"bytes"
 	"os"
 	"time"
 
 	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser"
 )
 
+// The timestamp layouts tried by default, in order. A fraction of second is
+// accepted after the seconds even when the layout has none
+var DefaultLayouts = []string{
+	time.Stamp,
+	time.RFC3339,
+	// RFC3339 without a colon in the offset
+	"2006-01-02T15:04:05Z0700",
+	// With the year before the month or after the day
+	"2006 Jan _2 15:04:05",
+	"Jan _2 2006 15:04:05",
+	// Cisco, "*" tells the clock is not synchronized
+	"*Jan _2 15:04:05: MST",
+	"*Jan _2 15:04:05:",
+	"Jan _2 15:04:05: MST",
+	"Jan _2 15:04:05:",
+}
+
 type Parser struct {
 	buff     []byte
 	cursor   int
@@ -17,7 +33,12 @@ type Parser struct {
 	header   header
 	message  rfc3164message
 	location *time.Location
+	layouts  []string
 	skipTag  bool
+	// The field being parsed, to locate the errors
+	field string
+	// buff converted once, the fields are sliced out of it
+	text string
 }
 
 type header struct {
@@ -27,6 +48,7 @@ type header struct {
 
 type rfc3164message struct {
 	tag     string
+	procId  string
 	content string
 }
 
@@ -39,17 +61,46 @@ func NewParser(buff []byte) *Parser {
 	}
 }
 
+// Prepares the parser for another message, keeping its location and layouts,
+// so parsers can be pooled
+func (p *Parser) Reset(buff []byte) {
+	*p = Parser{
+		buff:     buff,
+		l:        len(buff),
+		location: p.location,
+		layouts:  p.layouts,
+	}
+}
+
 func (p *Parser) Location(location *time.Location) {
 	p.location = location
 }
 
+// Sets the layouts of time.Parse tried in order on the timestamp, each on as
+// many space separated fields as it has, nil for DefaultLayouts. A message
+// matching none is given the current time and its tag is not parsed
+func (p *Parser) Layouts(layouts []string) {
+	p.layouts = layouts
+}
+
+// The errors are *syslogparser.FieldError, wrapping those of syslogparser
 func (p *Parser) Parse() error {
+	if err := p.parse(); err != nil {
+		return syslogparser.NewFieldError(err, p.field, p.buff, p.cursor)
+	}
+
+	return nil
+}
+
+func (p *Parser) parse() error {
 	tcursor := p.cursor
+	p.field = syslogparser.FieldPriority
 	pri, err := p.parsePriority()
 	if err != nil {
 		// RFC3164 sec 4.3.3
 		p.priority = syslogparser.Priority{13, syslogparser.Facility{Value: 1}, syslogparser.Severity{Value: 5}}
 		p.cursor = tcursor
+		p.field = syslogparser.FieldContent
 		content, err := p.parseContent()
 		p.header.timestamp = time.Now().Round(time.Second)
 		if err != syslogparser.ErrEOL {
@@ -87,11 +138,31 @@ func (p *Parser) Parse() error {
 	return nil
 }
 
+// Returns buff[from:to] as a string, all the fields share the conversion of
+// the whole buffer
+func (p *Parser) slice(from int, to int) string {
+	if p.text == "" {
+		p.text = string(p.buff)
+	}
+
+	return p.text[from:to]
+}
+
+// Returns the position of the cursor, where the parsing stopped on error
+func (p *Parser) Offset() int {
+	return p.cursor
+}
+
 func (p *Parser) Dump() syslogparser.LogParts {
+	// Boxed once for both keys
+	var tag interface{} = p.message.tag
+
 	return syslogparser.LogParts{
 		"timestamp": p.header.timestamp,
 		"hostname":  p.header.hostname,
-		"tag":       p.message.tag,
+		"tag":       tag,
+		"app_name":  tag,
+		"proc_id":   p.message.procId,
 		"content":   p.message.content,
 		"priority":  p.priority.P,
 		"facility":  p.priority.F.Value,
@@ -107,11 +178,13 @@ func (p *Parser) parseHeader() (header, error) {
 	hdr := header{}
 	var err error
 
+	p.field = syslogparser.FieldTimestamp
 	ts, err := p.parseTimestamp()
 	if err != nil {
 		return hdr, err
 	}
 
+	p.field = syslogparser.FieldHostname
 	hostname, err := p.parseHostname()
 	if err != nil {
 		return hdr, err
@@ -128,13 +201,16 @@ func (p *Parser) parsemessage() (rfc3164message, error) {
 	var err error
 
 	if !p.skipTag {
-		tag, err := p.parseTag()
+		p.field = syslogparser.FieldTag
+		tag, procId, err := p.parseTag()
 		if err != nil {
 			return msg, err
 		}
 		msg.tag = tag
+		msg.procId = procId
 	}
 
+	p.field = syslogparser.FieldContent
 	content, err := p.parseContent()
 	if err != syslogparser.ErrEOL {
 		return msg, err
@@ -149,32 +225,28 @@ func (p *Parser) parsemessage() (rfc3164message, error) {
 func (p *Parser) parseTimestamp() (time.Time, error) {
 	var ts time.Time
 	var err error
-	var tsFmtLen int
-	var sub []byte
-
-	tsFmts := []string{
-		time.Stamp,
-		time.RFC3339,
-	}
-	// if timestamps starts with numeric try formats with different order
-	// it is more likely that timestamp is in RFC3339 format then
-	if c := p.buff[p.cursor]; c > '0' && c < '9' {
-		tsFmts = []string{
-			time.RFC3339,
-			time.Stamp,
-		}
+
+	layouts := p.layouts
+	if layouts == nil {
+		layouts = DefaultLayouts
 	}
 
 	found := false
-	for _, tsFmt := range tsFmts {
-		tsFmtLen = len(tsFmt)
-
-		if p.cursor+tsFmtLen > p.l {
+	end := p.cursor
+	for _, layout := range layouts {
+		end = p.fieldsEnd(countFields(layout))
+		value := p.buff[p.cursor:end]
+		if !mayMatch(layout, value) {
 			continue
 		}
 
-		sub = p.buff[p.cursor : tsFmtLen+p.cursor]
-		ts, err = time.ParseInLocation(tsFmt, string(sub), p.location)
+		if layout == time.Stamp {
+			if ts, found = parseStamp(value, p.location); found {
+				break
+			}
+		}
+
+		ts, err = time.ParseInLocation(layout, string(value), p.location)
 		if err == nil {
 			found = true
 			break
@@ -190,12 +262,12 @@ func (p *Parser) parseTimestamp() (time.Time, error) {
 			p.cursor++
 		}
 
-		return ts, syslogparser.ErrTimestampUnknownFormat
+		return time.Time{}, syslogparser.ErrTimestampUnknownFormat
 	}
 
 	fixTimestampIfNeeded(&ts)
 
-	p.cursor += tsFmtLen
+	p.cursor = end
 
 	if (p.cursor < p.l) && (p.buff[p.cursor] == ' ') {
 		p.cursor++
@@ -204,10 +276,70 @@ func (p *Parser) parseTimestamp() (time.Time, error) {
 	return ts, nil
 }
 
+// Returns where the first n fields from the cursor end, fields being separated
+// by one or more spaces as with a space padded day
+func (p *Parser) fieldsEnd(n int) int {
+	i := p.cursor
+	for ; n > 0; n-- {
+		for i < p.l && p.buff[i] == ' ' {
+			i++
+		}
+		for i < p.l && p.buff[i] != ' ' {
+			i++
+		}
+	}
+
+	return i
+}
+
+func countFields(layout string) int {
+	n := 0
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != ' ' && (i == 0 || layout[i-1] == ' ') {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Tells from their first byte whether value may match layout, sparing the
+// parsing of the layouts which cannot: a digit for a number, a letter for a
+// name, the same byte otherwise
+func mayMatch(layout string, value []byte) bool {
+	if len(layout) == 0 || len(value) == 0 {
+		return false
+	}
+
+	l, v := layout[0], value[0]
+	switch {
+	case syslogparser.IsDigit(l):
+		return syslogparser.IsDigit(v)
+	case isLetter(l):
+		return isLetter(v)
+	case l == '_':
+		return true
+	default:
+		return l == v
+	}
+}
+
+func isLetter(c byte) bool {
+	return c|0x20 >= 'a' && c|0x20 <= 'z'
+}
+
 func (p *Parser) parseHostname() (string, error) {
 	oldcursor := p.cursor
-	hostname, err := syslogparser.ParseHostname(p.buff, &p.cursor, p.l)
-	if err == nil && len(hostname) > 0 && string(hostname[len(hostname)-1]) == ":" { // not an hostname! we found a GNU implementation of syslog()
+	if oldcursor >= p.l {
+		return "", syslogparser.ErrHostnameTooShort
+	}
+
+	for p.cursor < p.l && p.buff[p.cursor] != ' ' {
+		p.cursor++
+	}
+
+	hostname := p.slice(oldcursor, p.cursor)
+	if len(hostname) > 0 && hostname[len(hostname)-1] == ':' { // not an hostname! we found a GNU implementation of syslog()
 		p.cursor = oldcursor - 1
 		myhostname, err := os.Hostname()
 		if err == nil {
@@ -215,17 +347,21 @@ func (p *Parser) parseHostname() (string, error) {
 		}
 		return "", nil
 	}
-	return hostname, err
+	return hostname, nil
 }
 
 // http://tools.ietf.org/html/rfc3164#section-4.1.3
-func (p *Parser) parseTag() (string, error) {
+// The tag may be followed by the process ID in brackets, as in "sshd[1234]:"
+func (p *Parser) parseTag() (string, string, error) {
 	var b byte
 	var endOfTag bool
 	var bracketOpen bool
-	var tag []byte
+	var tag string
+	var procId string
 	var err error
 	var found bool
+	pidFrom := -1
+	pidTo := -1
 
 	from := p.cursor
 
@@ -233,22 +369,27 @@ func (p *Parser) parseTag() (string, error) {
 		if p.cursor == p.l {
 			// no tag found, reset cursor for content
 			p.cursor = from
-			return "", nil
+			return "", "", nil
 		}
 
 		b = p.buff[p.cursor]
 		bracketOpen = (b == '[')
 		endOfTag = (b == ':' || b == ' ')
 
-		// XXX : parse PID ?
-		if bracketOpen {
-			tag = p.buff[from:p.cursor]
+		if bracketOpen && !found {
+			tag = p.slice(from, p.cursor)
 			found = true
+			pidFrom = p.cursor + 1
+		}
+
+		if b == ']' && pidFrom >= 0 && pidTo < 0 {
+			pidTo = p.cursor
+			procId = p.slice(pidFrom, pidTo)
 		}
 
 		if endOfTag {
 			if !found {
-				tag = p.buff[from:p.cursor]
+				tag = p.slice(from, p.cursor)
 				found = true
 			}
 
@@ -263,7 +404,7 @@ func (p *Parser) parseTag() (string, error) {
 		p.cursor++
 	}
 
-	return string(tag), err
+	return tag, procId, err
 }
 
 func (p *Parser) parseContent() (string, error) {
@@ -271,10 +412,55 @@ func (p *Parser) parseContent() (string, error) {
 		return "", syslogparser.ErrEOL
 	}
 
-	content := bytes.Trim(p.buff[p.cursor:p.l], " ")
-	p.cursor += len(content)
+	from, to := p.cursor, p.l
+	for from < to && p.buff[from] == ' ' {
+		from++
+	}
+	for to > from && p.buff[to-1] == ' ' {
+		to--
+	}
+
+	p.cursor += to - from
+
+	return p.slice(from, to), syslogparser.ErrEOL
+}
+
+var shortMonths = [...]string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// Parses the usual form of time.Stamp, "Jan _2 15:04:05", without allocating.
+// Returns false for anything else, left to time.ParseInLocation
+func parseStamp(b []byte, location *time.Location) (time.Time, bool) {
+	if len(b) != len(time.Stamp) || b[3] != ' ' || b[6] != ' ' || b[9] != ':' || b[12] != ':' {
+		return time.Time{}, false
+	}
+
+	month := 0
+	for i, name := range shortMonths {
+		if b[0]|0x20 == name[0] && b[1]|0x20 == name[1] && b[2]|0x20 == name[2] {
+			month = i + 1
+			break
+		}
+	}
+
+	day, ok := syslogparser.ParseDigits(b[5:6])
+	if b[4] != ' ' {
+		day, ok = syslogparser.ParseDigits(b[4:6])
+	}
+	hour, hourOk := syslogparser.ParseDigits(b[7:9])
+	minute, minuteOk := syslogparser.ParseDigits(b[10:12])
+	second, secondOk := syslogparser.ParseDigits(b[13:15])
+	if month == 0 || !ok || !hourOk || !minuteOk || !secondOk {
+		return time.Time{}, false
+	}
+
+	// Without a year the day is checked against a leap year, as time.Parse
+	// does
+	daysIn := time.Date(0, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day < 1 || day > daysIn || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, false
+	}
 
-	return string(content), syslogparser.ErrEOL
+	return time.Date(0, time.Month(month), day, hour, minute, second, 0, location), true
 }
 
 func fixTimestampIfNeeded(ts *time.Time) {
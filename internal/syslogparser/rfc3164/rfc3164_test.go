@@ -46,6 +46,8 @@ func (s *Rfc3164TestSuite) TestParser_Valid(c *C) {
 		"timestamp": time.Date(now.Year(), time.October, 11, 22, 14, 15, 0, time.UTC),
 		"hostname":  "mymachine",
 		"tag":       "very.large.syslog.message.tag",
+		"app_name":  "very.large.syslog.message.tag",
+		"proc_id":   "",
 		"content":   "'su root' failed for lonvick on /dev/pts/8",
 		"priority":  34,
 		"facility":  4,
@@ -78,6 +80,8 @@ func (s *Rfc3164TestSuite) TestParser_ValidNoTag(c *C) {
 		"timestamp": time.Date(now.Year(), time.October, 11, 22, 14, 15, 0, time.UTC),
 		"hostname":  "mymachine",
 		"tag":       "",
+		"app_name":  "",
+		"proc_id":   "",
 		"content":   "singleword",
 		"priority":  34,
 		"facility":  4,
@@ -116,6 +120,8 @@ func (s *Rfc3164TestSuite) TestParser_NoTimestamp(c *C) {
 		"timestamp": now,
 		"hostname":  "",
 		"tag":       "",
+		"app_name":  "",
+		"proc_id":   "",
 		"content":   "INFO     leaving (1) step postscripts",
 		"priority":  14,
 		"facility":  1,
@@ -153,6 +159,8 @@ func (s *Rfc3164TestSuite) TestParser_NoPriority(c *C) {
 		"timestamp": now,
 		"hostname":  "",
 		"tag":       "",
+		"app_name":  "",
+		"proc_id":   "",
 		"content":   "Oct 11 22:14:15 Testing no priority",
 		"priority":  13,
 		"facility":  1,
@@ -205,6 +213,8 @@ func (s *Rfc3164TestSuite) TestParser_ValidRFC3339Timestamp(c *C) {
 		"timestamp": time.Date(2018, time.January, 12, 22, 14, 15, 0, time.UTC),
 		"hostname":  "mymachine",
 		"tag":       "app",
+		"app_name":  "app",
+		"proc_id":   "101",
 		"content":   "msg",
 		"priority":  34,
 		"facility":  4,
@@ -225,6 +235,7 @@ func (s *Rfc3164TestSuite) TestParsemessage_Valid(c *C) {
 	buff := []byte("sometag[123]: " + content)
 	hdr := rfc3164message{
 		tag:     "sometag",
+		procId:  "123",
 		content: content,
 	}
 
@@ -271,32 +282,144 @@ func (s *Rfc3164TestSuite) TestParseTimestamp_Valid(c *C) {
 	s.assertTimestamp(c, ts, buff, len(buff), nil)
 }
 
+func (s *Rfc3164TestSuite) TestParseTimestamp_DefaultLayouts(c *C) {
+	year := time.Now().Year()
+	for _, t := range []struct {
+		timestamp string
+		expected  time.Time
+	}{
+		{"Jan  2 15:04:05.123", time.Date(year, time.January, 2, 15, 4, 5, 123e6, time.UTC)},
+		{"Jan 2 15:04:05", time.Date(year, time.January, 2, 15, 4, 5, 0, time.UTC)},
+		{"2006 Jan 2 15:04:05", time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)},
+		{"Jan  2 2006 15:04:05", time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)},
+		{"*Mar  1 00:01:02.123: UTC", time.Date(year, time.March, 1, 0, 1, 2, 123e6, time.UTC)},
+		{"*Mar  1 00:01:02.123:", time.Date(year, time.March, 1, 0, 1, 2, 123e6, time.UTC)},
+		{"Mar  1 00:01:02.123:", time.Date(year, time.March, 1, 0, 1, 2, 123e6, time.UTC)},
+		{"2018-01-12T22:14:15.5+0100", time.Date(2018, time.January, 12, 21, 14, 15, 5e8, time.UTC)},
+		{"2018-01-12T22:14:15.000003Z", time.Date(2018, time.January, 12, 22, 14, 15, 3e3, time.UTC)},
+	} {
+		p := NewParser([]byte(t.timestamp + " mymachine"))
+		obtained, err := p.parseTimestamp()
+		c.Check(err, IsNil, Commentf("%q", t.timestamp))
+		c.Check(obtained.Equal(t.expected), Equals, true, Commentf("%q: %v", t.timestamp, obtained))
+		c.Check(p.cursor, Equals, len(t.timestamp)+1, Commentf("%q", t.timestamp))
+	}
+}
+
+func (s *Rfc3164TestSuite) TestParser_Layouts(c *C) {
+	buff := []byte("<34>2018/01/12 22:14:15 mymachine app[101]: msg")
+
+	p := NewParser(buff)
+	c.Assert(p.Parse(), IsNil)
+	c.Assert(p.Dump()["tag"], Equals, "")
+
+	p = NewParser(buff)
+	p.Layouts([]string{time.Stamp, "2006/01/02 15:04:05"})
+	c.Assert(p.Parse(), IsNil)
+	c.Assert(p.Dump()["timestamp"], Equals, time.Date(2018, time.January, 12, 22, 14, 15, 0, time.UTC))
+	c.Assert(p.Dump()["hostname"], Equals, "mymachine")
+	c.Assert(p.Dump()["tag"], Equals, "app")
+
+	p.Reset([]byte("<34>Oct 11 22:14:15 mymachine app[101]: msg"))
+	c.Assert(p.Parse(), IsNil)
+	c.Assert(p.Dump()["tag"], Equals, "app")
+
+	p.Layouts([]string{"2006/01/02 15:04:05"})
+	p.Reset([]byte("<34>Oct 11 22:14:15 mymachine app[101]: msg"))
+	c.Assert(p.Parse(), IsNil)
+	c.Assert(p.Dump()["tag"], Equals, "")
+}
+
+func (s *Rfc3164TestSuite) TestParser_Reset(c *C) {
+	first := "<34>Oct 11 22:14:15 mymachine su[42]: 'su root' failed"
+	second := "<13>hello"
+
+	p := NewParser([]byte(first))
+	p.Location(time.Local)
+	c.Assert(p.Parse(), IsNil)
+
+	p.Reset([]byte(second))
+	c.Assert(p.Parse(), IsNil)
+	c.Assert(p.Dump()["tag"], Equals, "")
+	c.Assert(p.Dump()["content"], Equals, "hello")
+
+	p.Reset([]byte(first))
+	c.Assert(p.Parse(), IsNil)
+	c.Assert(p.Dump()["proc_id"], Equals, "42")
+	c.Assert(p.Dump()["timestamp"].(time.Time).Location(), Equals, time.Local)
+}
+
+func (s *Rfc3164TestSuite) TestParseStamp(c *C) {
+	for _, t := range []struct {
+		stamp string
+		ok    bool
+	}{
+		{"Oct 11 22:14:15", true},
+		{"Jan  2 15:04:05", true},
+		{"Jan 02 15:04:05", true},
+		{"jAN 11 15:04:05", true},
+		{"Feb 29 00:00:00", true},
+		{"Feb 30 00:00:00", false},
+		{"Dec 31 24:00:00", false},
+		{"Foo 11 22:14:15", false},
+		{"Oct 11 22:14:1a", false},
+		{"Jan 2  15:04:05", false},
+	} {
+		obtained, ok := parseStamp([]byte(t.stamp), time.UTC)
+		c.Check(ok, Equals, t.ok, Commentf("%q", t.stamp))
+		if ok {
+			expected, err := time.ParseInLocation(time.Stamp, t.stamp, time.UTC)
+			c.Check(err, IsNil, Commentf("%q", t.stamp))
+			c.Check(obtained, Equals, expected, Commentf("%q", t.stamp))
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		parseStamp([]byte("Oct 11 22:14:15"), time.UTC)
+	})
+	c.Assert(allocs, Equals, 0.0)
+}
+
 func (s *Rfc3164TestSuite) TestParseTag_Pid(c *C) {
 	buff := []byte("apache2[10]:")
 	tag := "apache2"
 
-	s.assertTag(c, tag, buff, len(buff), nil)
+	s.assertTag(c, tag, "10", buff, len(buff), nil)
+}
+
+func (s *Rfc3164TestSuite) TestParseTag_PidAndSpace(c *C) {
+	buff := []byte("sshd[1234] ")
+	tag := "sshd"
+
+	s.assertTag(c, tag, "1234", buff, len(buff), nil)
+}
+
+func (s *Rfc3164TestSuite) TestParseTag_UnclosedPid(c *C) {
+	buff := []byte("sshd[1234:")
+	tag := "sshd"
+
+	s.assertTag(c, tag, "", buff, len(buff), nil)
 }
 
 func (s *Rfc3164TestSuite) TestParseTag_NoPid(c *C) {
 	buff := []byte("apache2:")
 	tag := "apache2"
 
-	s.assertTag(c, tag, buff, len(buff), nil)
+	s.assertTag(c, tag, "", buff, len(buff), nil)
 }
 
 func (s *Rfc3164TestSuite) TestParseTag_TrailingSpace(c *C) {
 	buff := []byte("apache2: ")
 	tag := "apache2"
 
-	s.assertTag(c, tag, buff, len(buff), nil)
+	s.assertTag(c, tag, "", buff, len(buff), nil)
 }
 
 func (s *Rfc3164TestSuite) TestParseTag_NoTag(c *C) {
 	buff := []byte("apache2")
 	tag := ""
 
-	s.assertTag(c, tag, buff, 0, nil)
+	s.assertTag(c, tag, "", buff, 0, nil)
 }
 
 func (s *Rfc3164TestSuite) TestParseContent_Valid(c *C) {
@@ -346,7 +469,7 @@ func (s *Rfc3164TestSuite) BenchmarkParseTag(c *C) {
 	p := NewParser(buff)
 
 	for i := 0; i < c.N; i++ {
-		_, err := p.parseTag()
+		_, _, err := p.parseTag()
 		if err != nil {
 			panic(err)
 		}
@@ -393,10 +516,11 @@ func (s *Rfc3164TestSuite) assertTimestamp(c *C, ts time.Time, b []byte, expC in
 	c.Assert(err, Equals, e)
 }
 
-func (s *Rfc3164TestSuite) assertTag(c *C, t string, b []byte, expC int, e error) {
+func (s *Rfc3164TestSuite) assertTag(c *C, t string, pid string, b []byte, expC int, e error) {
 	p := NewParser(b)
-	obtained, err := p.parseTag()
+	obtained, procId, err := p.parseTag()
 	c.Assert(obtained, Equals, t)
+	c.Assert(procId, Equals, pid)
 	c.Assert(p.cursor, Equals, expC)
 	c.Assert(err, Equals, e)
 }
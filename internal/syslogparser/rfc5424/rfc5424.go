@@ -4,9 +4,8 @@
 package rfc5424
 
 import (
-	"fmt"
 	"math"
-	"strconv"
+	"sync"
 	"time"
 
 	"gopkg.in/mcuadros/go-syslog.v2/internal/syslogparser"
@@ -30,15 +29,28 @@ var (
 	ErrInvalidProcId     = &syslogparser.ParserError{"Invalid proc ID"}
 	ErrInvalidMsgId      = &syslogparser.ParserError{"Invalid msg ID"}
 	ErrNoStructuredData  = &syslogparser.ParserError{"No structured data"}
+	ErrInvalidSDName     = &syslogparser.ParserError{ErrorString: "Invalid SD-ID or PARAM-NAME in structured data"}
+	ErrInvalidSDParam    = &syslogparser.ParserError{ErrorString: "Invalid SD-PARAM in structured data"}
+	ErrInvalidPriority   = &syslogparser.ParserError{ErrorString: "Priority above 191"}
+	ErrInvalidVersion    = &syslogparser.ParserError{ErrorString: "Invalid version"}
+	ErrInvalidHostname   = &syslogparser.ParserError{ErrorString: "Invalid hostname"}
 )
 
 type Parser struct {
-	buff           []byte
-	cursor         int
-	l              int
-	header         header
-	structuredData string
-	message        string
+	buff                   []byte
+	cursor                 int
+	l                      int
+	header                 header
+	structuredData         string
+	structuredDataElements []syslogparser.SDElement
+	message                string
+	strict                 bool
+	// The field being parsed, to locate the errors
+	field string
+	// The deviations from the RFC recovered in lenient mode
+	warnings []string
+	// buff converted once, the fields are sliced out of it
+	text string
 }
 
 type header struct {
@@ -77,11 +89,64 @@ func NewParser(buff []byte) *Parser {
 	}
 }
 
+// Prepares the parser for another message, keeping its settings, so parsers
+// can be pooled
+func (p *Parser) Reset(buff []byte) {
+	*p = Parser{
+		buff:   buff,
+		l:      len(buff),
+		strict: p.strict,
+	}
+}
+
 func (p *Parser) Location(location *time.Location) {
 	// Ignore as RFC5424 syslog always has a timezone
 }
 
+// In strict mode any deviation from the RFC is an error. The default lenient
+// mode recovers from the following ones, recording a warning for each:
+//   - a priority above 191
+//   - a version other than 1
+//   - a day of month past the end of the month, the date then moves forward
+//   - a dot without digits after the seconds, or a missing time offset at the
+//     end of the message taken as UTC
+//   - a hostname, app name, proc ID or msg ID with characters out of
+//     PRINTUSASCII
+//   - an invalid proc ID or msg ID, the header then ends before it
+//   - a missing space after a header field or the structured data
+//   - SD params not separated by a single space, spaces after their "=" or
+//     before the "]" ending the element, an unescaped "]" in their value
+//   - structured data out of the grammar otherwise, like unquoted param
+//     values, kept as the raw string up to the first "]" followed by a space,
+//     without elements
+func (p *Parser) Strict(strict bool) {
+	p.strict = strict
+}
+
+// Fails on a deviation from the RFC in strict mode, records it as a warning
+// otherwise
+func (p *Parser) deviation(err error) error {
+	if p.strict {
+		return err
+	}
+
+	p.warnings = append(p.warnings, err.Error())
+	return nil
+}
+
+// The errors are *syslogparser.FieldError, wrapping the errors of this package
+// and syslogparser
 func (p *Parser) Parse() error {
+	p.warnings = nil
+
+	if err := p.parse(); err != nil {
+		return syslogparser.NewFieldError(err, p.field, p.buff, p.cursor)
+	}
+
+	return nil
+}
+
+func (p *Parser) parse() error {
 	hdr, err := p.parseHeader()
 	if err != nil {
 		return err
@@ -89,23 +154,42 @@ func (p *Parser) Parse() error {
 
 	p.header = hdr
 
-	sd, err := p.parseStructuredData()
+	p.field = syslogparser.FieldStructuredData
+	elements, sd, err := p.parseStructuredData()
 	if err != nil {
 		return err
 	}
 
 	p.structuredData = sd
-	p.cursor++
+	p.structuredDataElements = elements
+	if err := p.parseSpace(); err != nil {
+		return err
+	}
 
 	if p.cursor < p.l {
-		p.message = string(p.buff[p.cursor:])
+		p.message = p.slice(p.cursor, p.l)
 	}
 
 	return nil
 }
 
+// Returns buff[from:to] as a string, all the fields share the conversion of
+// the whole buffer
+func (p *Parser) slice(from int, to int) string {
+	if p.text == "" {
+		p.text = string(p.buff)
+	}
+
+	return p.text[from:to]
+}
+
+// Returns the position of the cursor, where the parsing stopped on error
+func (p *Parser) Offset() int {
+	return p.cursor
+}
+
 func (p *Parser) Dump() syslogparser.LogParts {
-	return syslogparser.LogParts{
+	logParts := syslogparser.LogParts{
 		"priority":        p.header.priority.P,
 		"facility":        p.header.priority.F.Value,
 		"severity":        p.header.priority.S.Value,
@@ -117,13 +201,22 @@ func (p *Parser) Dump() syslogparser.LogParts {
 		"msg_id":          p.header.msgId,
 		"structured_data": p.structuredData,
 		"message":         p.message,
+
+		"structured_data_elements": p.structuredDataElements,
+	}
+
+	if len(p.warnings) > 0 {
+		logParts["warnings"] = p.warnings
 	}
+
+	return logParts
 }
 
 // HEADER = PRI VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID
 func (p *Parser) parseHeader() (header, error) {
 	hdr := header{}
 
+	p.field = syslogparser.FieldPriority
 	pri, err := p.parsePriority()
 	if err != nil {
 		return hdr, err
@@ -131,21 +224,28 @@ func (p *Parser) parseHeader() (header, error) {
 
 	hdr.priority = pri
 
+	p.field = syslogparser.FieldVersion
 	ver, err := p.parseVersion()
 	if err != nil {
 		return hdr, err
 	}
 	hdr.version = ver
-	p.cursor++
+	if err := p.parseSpace(); err != nil {
+		return hdr, err
+	}
 
+	p.field = syslogparser.FieldTimestamp
 	ts, err := p.parseTimestamp()
 	if err != nil {
 		return hdr, err
 	}
 
 	hdr.timestamp = ts
-	p.cursor++
+	if err := p.parseSpace(); err != nil {
+		return hdr, err
+	}
 
+	p.field = syslogparser.FieldHostname
 	host, err := p.parseHostname()
 	if err != nil {
 		return hdr, err
@@ -154,6 +254,7 @@ func (p *Parser) parseHeader() (header, error) {
 	hdr.hostname = host
 	p.cursor++
 
+	p.field = syslogparser.FieldAppName
 	appName, err := p.parseAppName()
 	if err != nil {
 		return hdr, err
@@ -162,17 +263,19 @@ func (p *Parser) parseHeader() (header, error) {
 	hdr.appName = appName
 	p.cursor++
 
+	p.field = syslogparser.FieldProcId
 	procId, err := p.parseProcId()
 	if err != nil {
-		return hdr, nil
+		return hdr, p.deviation(err)
 	}
 
 	hdr.procId = procId
 	p.cursor++
 
+	p.field = syslogparser.FieldMsgId
 	msgId, err := p.parseMsgId()
 	if err != nil {
-		return hdr, nil
+		return hdr, p.deviation(err)
 	}
 
 	hdr.msgId = msgId
@@ -181,12 +284,47 @@ func (p *Parser) parseHeader() (header, error) {
 	return hdr, nil
 }
 
+// Skips the space ending a field
+func (p *Parser) parseSpace() error {
+	if p.cursor < p.l && p.buff[p.cursor] != ' ' {
+		if err := p.deviation(syslogparser.ErrNoSpace); err != nil {
+			return err
+		}
+	}
+
+	p.cursor++
+	return nil
+}
+
+// Checks a field is made of PRINTUSASCII characters, %d33-126
+func (p *Parser) checkPrintUSASCII(field string, e error) error {
+	for i := 0; i < len(field); i++ {
+		if field[i] < 33 || field[i] > 126 {
+			return p.deviation(e)
+		}
+	}
+
+	return nil
+}
+
+// PRI = "<" PRIVAL ">", PRIVAL = 1*3DIGIT ; range 0 .. 191
 func (p *Parser) parsePriority() (syslogparser.Priority, error) {
-	return syslogparser.ParsePriority(p.buff, &p.cursor, p.l)
+	pri, err := syslogparser.ParsePriority(p.buff, &p.cursor, p.l)
+	if err == nil && pri.P > 191 {
+		err = p.deviation(ErrInvalidPriority)
+	}
+
+	return pri, err
 }
 
+// VERSION = NONZERO-DIGIT 0*2DIGIT, only 1 is defined
 func (p *Parser) parseVersion() (int, error) {
-	return syslogparser.ParseVersion(p.buff, &p.cursor, p.l)
+	ver, err := syslogparser.ParseVersion(p.buff, &p.cursor, p.l)
+	if err == nil && ver != 1 {
+		err = p.deviation(ErrInvalidVersion)
+	}
+
+	return ver, err
 }
 
 // https://tools.ietf.org/html/rfc5424#section-6.2.3
@@ -207,13 +345,21 @@ func (p *Parser) parseTimestamp() (time.Time, error) {
 		return ts, err
 	}
 
+	// The day was only checked against 31, time.Date moves past the end of
+	// the month to the next one
+	if fd.day > daysIn(fd.month, fd.year) {
+		if err := p.deviation(ErrDayInvalid); err != nil {
+			return ts, err
+		}
+	}
+
 	if p.cursor >= p.l || p.buff[p.cursor] != 'T' {
 		return ts, ErrInvalidTimeFormat
 	}
 
 	p.cursor++
 
-	ft, err := parseFullTime(p.buff, &p.cursor, p.l)
+	ft, err := p.parseFullTime()
 	if err != nil {
 		return ts, syslogparser.ErrTimestampUnknownFormat
 	}
@@ -239,26 +385,260 @@ func (p *Parser) parseTimestamp() (time.Time, error) {
 
 // HOSTNAME = NILVALUE / 1*255PRINTUSASCII
 func (p *Parser) parseHostname() (string, error) {
-	return syslogparser.ParseHostname(p.buff, &p.cursor, p.l)
+	if p.cursor >= p.l {
+		return "", syslogparser.ErrHostnameTooShort
+	}
+
+	from := p.cursor
+	for p.cursor < p.l && p.buff[p.cursor] != ' ' {
+		p.cursor++
+	}
+
+	hostname := p.slice(from, p.cursor)
+
+	if len(hostname) > 255 {
+		return hostname, p.deviation(ErrInvalidHostname)
+	}
+
+	return hostname, p.checkPrintUSASCII(hostname, ErrInvalidHostname)
 }
 
 // APP-NAME = NILVALUE / 1*48PRINTUSASCII
 func (p *Parser) parseAppName() (string, error) {
-	return parseUpToLen(p.buff, &p.cursor, p.l, 48, ErrInvalidAppName)
+	return p.parseField(48, ErrInvalidAppName)
 }
 
 // PROCID = NILVALUE / 1*128PRINTUSASCII
 func (p *Parser) parseProcId() (string, error) {
-	return parseUpToLen(p.buff, &p.cursor, p.l, 128, ErrInvalidProcId)
+	return p.parseField(128, ErrInvalidProcId)
 }
 
 // MSGID = NILVALUE / 1*32PRINTUSASCII
 func (p *Parser) parseMsgId() (string, error) {
-	return parseUpToLen(p.buff, &p.cursor, p.l, 32, ErrInvalidMsgId)
+	return p.parseField(32, ErrInvalidMsgId)
 }
 
-func (p *Parser) parseStructuredData() (string, error) {
-	return parseStructuredData(p.buff, &p.cursor, p.l)
+func (p *Parser) parseField(maxLen int, e error) (string, error) {
+	from := p.cursor
+	if err := parseUpToLen(p.buff, &p.cursor, p.l, maxLen, e); err != nil {
+		return "", err
+	}
+
+	field := p.slice(from, p.cursor)
+
+	return field, p.checkPrintUSASCII(field, e)
+}
+
+// STRUCTURED-DATA = NILVALUE / 1*SD-ELEMENT
+// Returns the parsed elements along with the raw STRUCTURED-DATA string
+func (p *Parser) parseStructuredData() ([]syslogparser.SDElement, string, error) {
+	var elements []syslogparser.SDElement
+
+	if p.cursor >= p.l {
+		return elements, "-", nil
+	}
+
+	if p.buff[p.cursor] == NILVALUE {
+		p.cursor++
+		return elements, "-", nil
+	}
+
+	if p.buff[p.cursor] != '[' {
+		return elements, "", ErrNoStructuredData
+	}
+
+	from := p.cursor
+	warnings := len(p.warnings)
+
+	for p.cursor < p.l && p.buff[p.cursor] == '[' {
+		element, err := p.parseSDElement()
+		if err != nil {
+			p.cursor = from
+			if p.strict {
+				return nil, "", err
+			}
+
+			// Only the raw string is kept of the elements out of the
+			// grammar, up to the "]" followed by a space or the end
+			to := p.structuredDataEnd(from)
+			if to < 0 {
+				return nil, "", err
+			}
+
+			p.warnings = p.warnings[:warnings]
+			p.cursor = to
+			return nil, p.slice(from, to), p.deviation(err)
+		}
+
+		elements = append(elements, element)
+	}
+
+	return elements, p.slice(from, p.cursor), nil
+}
+
+// Returns the position after the "]" ending the structured data starting at
+// from, the first one followed by a space or the end, -1 if there is none
+func (p *Parser) structuredDataEnd(from int) int {
+	for to := from; to < p.l; to++ {
+		if p.buff[to] == ']' && (to+1 == p.l || p.buff[to+1] == ' ') {
+			return to + 1
+		}
+	}
+
+	return -1
+}
+
+// SD-ELEMENT = "[" SD-ID *(SP SD-PARAM) "]"
+func (p *Parser) parseSDElement() (syslogparser.SDElement, error) {
+	var element syslogparser.SDElement
+
+	p.cursor++
+
+	from := p.cursor
+	if err := parseSDName(p.buff, &p.cursor, p.l); err != nil {
+		return element, err
+	}
+
+	element.ID = p.slice(from, p.cursor)
+
+	for first := true; ; first = false {
+		spaces := 0
+		for p.cursor < p.l && p.buff[p.cursor] == ' ' {
+			p.cursor++
+			spaces++
+		}
+
+		if p.cursor >= p.l {
+			return element, ErrNoStructuredData
+		}
+
+		if p.buff[p.cursor] == ']' {
+			if spaces > 0 {
+				if err := p.deviation(ErrInvalidSDParam); err != nil {
+					return element, err
+				}
+			}
+			p.cursor++
+			return element, nil
+		}
+
+		// Every param follows a single space, right after the ID the name
+		// check fails anyway
+		if spaces == 0 && !first {
+			if err := p.deviation(syslogparser.ErrNoSpace); err != nil {
+				return element, err
+			}
+		} else if spaces > 1 {
+			if err := p.deviation(ErrInvalidSDParam); err != nil {
+				return element, err
+			}
+		}
+
+		param, err := p.parseSDParam()
+		if err != nil {
+			return element, err
+		}
+
+		if element.Params == nil {
+			element.Params = make([]syslogparser.SDParam, 0, 4)
+		}
+		element.Params = append(element.Params, param)
+	}
+}
+
+// SD-PARAM = PARAM-NAME "=" %d34 PARAM-VALUE %d34
+func (p *Parser) parseSDParam() (syslogparser.SDParam, error) {
+	var param syslogparser.SDParam
+
+	from := p.cursor
+	if err := parseSDName(p.buff, &p.cursor, p.l); err != nil {
+		return param, err
+	}
+
+	name := p.slice(from, p.cursor)
+
+	if p.cursor >= p.l || p.buff[p.cursor] != '=' {
+		return param, ErrInvalidSDParam
+	}
+
+	p.cursor++
+
+	if p.cursor < p.l && p.buff[p.cursor] == ' ' {
+		if err := p.deviation(ErrInvalidSDParam); err != nil {
+			return param, err
+		}
+		for p.cursor < p.l && p.buff[p.cursor] == ' ' {
+			p.cursor++
+		}
+	}
+
+	if p.cursor >= p.l || p.buff[p.cursor] != '"' {
+		return param, ErrInvalidSDParam
+	}
+
+	p.cursor++
+
+	value, err := p.parseSDParamValue()
+	if err != nil {
+		return param, err
+	}
+
+	param.Name = name
+	param.Value = value
+
+	return param, nil
+}
+
+// PARAM-VALUE = UTF-8-STRING ; characters '"', '\' and ']' MUST be escaped.
+// The cursor is left after the closing quote
+func (p *Parser) parseSDParamValue() (string, error) {
+	from := p.cursor
+	var value []byte
+
+	for ; p.cursor < p.l; p.cursor++ {
+		c := p.buff[p.cursor]
+
+		if c == '"' {
+			p.cursor++
+			if value == nil {
+				return p.slice(from, p.cursor-1), nil
+			}
+
+			return string(value), nil
+		}
+
+		if c == ']' {
+			if err := p.deviation(ErrInvalidSDParam); err != nil {
+				return "", err
+			}
+		}
+
+		if c != '\\' || p.cursor+1 >= p.l {
+			if value != nil {
+				value = append(value, c)
+			}
+			continue
+		}
+
+		// A backslash not followed by one of the escaped characters is
+		// kept as a normal character
+		next := p.buff[p.cursor+1]
+		if next != '"' && next != '\\' && next != ']' {
+			if value != nil {
+				value = append(value, c)
+			}
+			continue
+		}
+
+		if value == nil {
+			value = append(make([]byte, 0, p.l-from), p.buff[from:p.cursor]...)
+		}
+
+		value = append(value, next)
+		p.cursor++
+	}
+
+	return "", ErrInvalidSDParam
 }
 
 // ----------------------------------------------
@@ -315,14 +695,12 @@ func parseYear(buff []byte, cursor *int, l int) (int, error) {
 		return 0, syslogparser.ErrEOL
 	}
 
-	// XXX : we do not check for a valid year (ie. 1999, 2013 etc)
-	// XXX : we only checks the format is correct
-	sub := string(buff[*cursor : *cursor+yearLen])
+	// Any 4 digits make a valid year
+	year, ok := syslogparser.ParseDigits(buff[*cursor : *cursor+yearLen])
 
 	*cursor += yearLen
 
-	year, err := strconv.Atoi(sub)
-	if err != nil {
+	if !ok {
 		return 0, ErrYearInvalid
 	}
 
@@ -335,25 +713,27 @@ func parseMonth(buff []byte, cursor *int, l int) (int, error) {
 }
 
 // DATE-MDAY = 2DIGIT  ; 01-28, 01-29, 01-30, 01-31 based on month/year
+// Only the range [01 -> 31] is checked here, the month and year being needed
+// for the rest, see daysIn
 func parseDay(buff []byte, cursor *int, l int) (int, error) {
-	// XXX : this is a relaxed constraint
-	// XXX : we do not check if valid regarding February or leap years
-	// XXX : we only checks that day is in range [01 -> 31]
-	// XXX : in other words this function will not rant if you provide Feb 31th
 	return syslogparser.Parse2Digits(buff, cursor, l, 1, 31, ErrDayInvalid)
 }
 
+// Number of days of the month, February of leap years included
+func daysIn(month int, year int) int {
+	return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
 // FULL-TIME = PARTIAL-TIME TIME-OFFSET
-func parseFullTime(buff []byte, cursor *int, l int) (fullTime, error) {
-	var loc = new(time.Location)
+func (p *Parser) parseFullTime() (fullTime, error) {
 	var ft fullTime
 
-	pt, err := parsePartialTime(buff, cursor, l)
+	pt, err := p.parsePartialTime()
 	if err != nil {
 		return ft, err
 	}
 
-	loc, err = parseTimeOffset(buff, cursor, l)
+	loc, err := p.parseTimeOffset()
 	if err != nil {
 		return ft, err
 	}
@@ -367,23 +747,23 @@ func parseFullTime(buff []byte, cursor *int, l int) (fullTime, error) {
 }
 
 // PARTIAL-TIME = TIME-HOUR ":" TIME-MINUTE ":" TIME-SECOND[TIME-SECFRAC]
-func parsePartialTime(buff []byte, cursor *int, l int) (partialTime, error) {
+func (p *Parser) parsePartialTime() (partialTime, error) {
 	var pt partialTime
 
-	hour, minute, err := getHourMinute(buff, cursor, l)
+	hour, minute, err := getHourMinute(p.buff, &p.cursor, p.l)
 	if err != nil {
 		return pt, err
 	}
 
-	if *cursor >= l || buff[*cursor] != ':' {
+	if p.cursor >= p.l || p.buff[p.cursor] != ':' {
 		return pt, ErrInvalidTimeFormat
 	}
 
-	*cursor++
+	p.cursor++
 
 	// ----
 
-	seconds, err := parseSecond(buff, cursor, l)
+	seconds, err := parseSecond(p.buff, &p.cursor, p.l)
 	if err != nil {
 		return pt, err
 	}
@@ -396,15 +776,16 @@ func parsePartialTime(buff []byte, cursor *int, l int) (partialTime, error) {
 
 	// ----
 
-	if *cursor >= l || buff[*cursor] != '.' {
+	if p.cursor >= p.l || p.buff[p.cursor] != '.' {
 		return pt, nil
 	}
 
-	*cursor++
+	p.cursor++
 
-	secFrac, err := parseSecFrac(buff, cursor, l)
+	// A dot without digits is ignored
+	secFrac, err := parseSecFrac(p.buff, &p.cursor, p.l)
 	if err != nil {
-		return pt, nil
+		return pt, p.deviation(err)
 	}
 	pt.secFrac = secFrac
 
@@ -445,55 +826,79 @@ func parseSecFrac(buff []byte, cursor *int, l int) (float64, error) {
 		}
 	}
 
-	sub := string(buff[from:to])
-	if len(sub) == 0 {
-		return 0, ErrSecFracInvalid
-	}
-
-	secFrac, err := strconv.ParseFloat("0."+sub, 64)
+	digits, ok := syslogparser.ParseDigits(buff[from:to])
 	*cursor = to
-	if err != nil {
+	if !ok {
 		return 0, ErrSecFracInvalid
 	}
 
-	return secFrac, nil
+	return float64(digits) / math.Pow10(to-from), nil
 }
 
 // TIME-OFFSET = "Z" / TIME-NUMOFFSET
-func parseTimeOffset(buff []byte, cursor *int, l int) (*time.Location, error) {
+func (p *Parser) parseTimeOffset() (*time.Location, error) {
+	// A missing offset is taken as UTC
+	if p.cursor >= p.l {
+		return time.UTC, p.deviation(ErrTimeZoneInvalid)
+	}
 
-	if *cursor >= l || buff[*cursor] == 'Z' {
-		*cursor++
+	if p.buff[p.cursor] == 'Z' {
+		p.cursor++
 		return time.UTC, nil
 	}
 
-	return parseNumericalTimeOffset(buff, cursor, l)
+	return parseNumericalTimeOffset(p.buff, &p.cursor, p.l)
 }
 
 // TIME-NUMOFFSET  = ("+" / "-") TIME-HOUR ":" TIME-MINUTE
 func parseNumericalTimeOffset(buff []byte, cursor *int, l int) (*time.Location, error) {
-	var loc = new(time.Location)
-
 	sign := buff[*cursor]
 
 	if (sign != '+') && (sign != '-') {
-		return loc, ErrTimeZoneInvalid
+		return nil, ErrTimeZoneInvalid
 	}
 
 	*cursor++
 
 	hour, minute, err := getHourMinute(buff, cursor, l)
 	if err != nil {
-		return loc, err
+		return nil, err
 	}
 
-	tzStr := fmt.Sprintf("%s%02d:%02d", string(sign), hour, minute)
-	tmpTs, err := time.Parse("-07:00", tzStr)
-	if err != nil {
-		return loc, err
+	offset := hour*3600 + minute*60
+	if sign == '-' {
+		offset = -offset
 	}
 
-	return tmpTs.Location(), nil
+	return fixedZone(offset), nil
+}
+
+// The locations of the time offsets met so far, shared by the parsers so a
+// timestamp does not allocate one
+var fixedZones = struct {
+	sync.RWMutex
+	locations map[int]*time.Location
+}{locations: make(map[int]*time.Location)}
+
+// Returns the location of an offset in seconds east of UTC, unnamed as those
+// of time.Parse
+func fixedZone(offset int) *time.Location {
+	fixedZones.RLock()
+	loc, ok := fixedZones.locations[offset]
+	fixedZones.RUnlock()
+	if ok {
+		return loc
+	}
+
+	fixedZones.Lock()
+	defer fixedZones.Unlock()
+	if loc, ok := fixedZones.locations[offset]; ok {
+		return loc
+	}
+
+	loc = time.FixedZone("", offset)
+	fixedZones.locations[offset] = loc
+	return loc
 }
 
 func getHourMinute(buff []byte, cursor *int, l int) (int, int, error) {
@@ -518,68 +923,43 @@ func getHourMinute(buff []byte, cursor *int, l int) (int, int, error) {
 
 func toNSec(sec float64) (int, error) {
 	_, frac := math.Modf(sec)
-	fracStr := strconv.FormatFloat(frac, 'f', 9, 64)
-	fracInt, err := strconv.Atoi(fracStr[2:])
-	if err != nil {
-		return 0, err
-	}
 
-	return fracInt, nil
+	return int(math.Round(frac * 1e9)), nil
 }
 
 // ------------------------------------------------
 // https://tools.ietf.org/html/rfc5424#section-6.3
 // ------------------------------------------------
 
-func parseStructuredData(buff []byte, cursor *int, l int) (string, error) {
-	var sdData string
-	var found bool
-
-	if *cursor >= l {
-		return "-", nil
-	}
-
-	if buff[*cursor] == NILVALUE {
-		*cursor++
-		return "-", nil
-	}
-
-	if buff[*cursor] != '[' {
-		return sdData, ErrNoStructuredData
-	}
-
+// SD-ID = SD-NAME
+// PARAM-NAME = SD-NAME
+// SD-NAME = 1*32PRINTUSASCII ; except '=', SP, ']', %d34 (")
+// The cursor is left after the name
+func parseSDName(buff []byte, cursor *int, l int) error {
 	from := *cursor
-	to := from
 
-	for to = from; to < l; to++ {
-		if found {
+	for ; *cursor < l; *cursor++ {
+		c := buff[*cursor]
+		if c == '=' || c == ' ' || c == ']' || c == '"' {
 			break
 		}
 
-		b := buff[to]
-
-		if b == ']' {
-			switch t := to + 1; {
-			case t == l:
-				found = true
-			case t <= l && buff[t] == ' ':
-				found = true
-			}
+		if c < 33 || c > 126 {
+			return ErrInvalidSDName
 		}
 	}
 
-	if found {
-		*cursor = to
-		return string(buff[from:to]), nil
+	if *cursor == from || *cursor-from > 32 {
+		return ErrInvalidSDName
 	}
 
-	return sdData, ErrNoStructuredData
+	return nil
 }
 
-func parseUpToLen(buff []byte, cursor *int, l int, maxLen int, e error) (string, error) {
+// Moves the cursor to the space ending a field of at most maxLen bytes
+func parseUpToLen(buff []byte, cursor *int, l int, maxLen int, e error) error {
 	var to int
 	var found bool
-	var result string
 
 	max := *cursor + maxLen
 
@@ -590,17 +970,15 @@ func parseUpToLen(buff []byte, cursor *int, l int, maxLen int, e error) (string,
 		}
 	}
 
-	if found {
-		result = string(buff[*cursor:to])
-	} else if to > max {
+	if !found && to > max {
 		to = max // don't go past max
 	}
 
 	*cursor = to
 
 	if found {
-		return result, nil
+		return nil
 	}
 
-	return "", e
+	return e
 }
@@ -1,6 +1,7 @@
 package rfc5424
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -47,6 +48,8 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"msg_id":          "ID47",
 			"structured_data": "-",
 			"message":         "'su root' failed for lonvick on /dev/pts/8",
+
+			"structured_data_elements": []syslogparser.SDElement(nil),
 		},
 		syslogparser.LogParts{
 			"priority":        165,
@@ -60,6 +63,8 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"msg_id":          "-",
 			"structured_data": "-",
 			"message":         "%% It's time to make the do-nuts.",
+
+			"structured_data_elements": []syslogparser.SDElement(nil),
 		},
 		syslogparser.LogParts{
 			"priority":        165,
@@ -73,6 +78,8 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"msg_id":          "-",
 			"structured_data": "-",
 			"message":         "%% It's time to make the do-nuts.",
+
+			"structured_data_elements": []syslogparser.SDElement(nil),
 		},
 		syslogparser.LogParts{
 			"priority":        165,
@@ -86,6 +93,10 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"msg_id":          "ID47",
 			"structured_data": `[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"]`,
 			"message":         "An application event log entry...",
+
+			"structured_data_elements": []syslogparser.SDElement{
+				{ID: "exampleSDID@32473", Params: []syslogparser.SDParam{{Name: "iut", Value: "3"}, {Name: "eventSource", Value: "Application"}, {Name: "eventID", Value: "1011"}}},
+			},
 		},
 		syslogparser.LogParts{
 			"priority":        165,
@@ -99,6 +110,13 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"msg_id":          "ID47",
 			"structured_data": `[exampleSDID@32473 iut="3" eventSource= "Application" eventID="1011"][examplePriority@32473 class="high"]`,
 			"message":         "",
+
+			"structured_data_elements": []syslogparser.SDElement{
+				{ID: "exampleSDID@32473", Params: []syslogparser.SDParam{{Name: "iut", Value: "3"}, {Name: "eventSource", Value: "Application"}, {Name: "eventID", Value: "1011"}}},
+				{ID: "examplePriority@32473", Params: []syslogparser.SDParam{{Name: "class", Value: "high"}}},
+			},
+			// The space after "eventSource=" is a deviation
+			"warnings": []string{ErrInvalidSDParam.Error()},
 		},
 		syslogparser.LogParts{
 			"priority":        165,
@@ -112,6 +130,8 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 			"msg_id":          "ID47",
 			"structured_data": "-",
 			"message":         "",
+
+			"structured_data_elements": []syslogparser.SDElement(nil),
 		},
 	}
 
@@ -137,6 +157,38 @@ func (s *Rfc5424TestSuite) TestParser_Valid(c *C) {
 	}
 }
 
+func (s *Rfc5424TestSuite) TestParser_Reset(c *C) {
+	first := "<34>1 2003-02-30T22:14:15.003Z host su - ID47 [id@1 a=\"b\"] msg"
+	second := "<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts."
+
+	p := NewParser([]byte(first))
+	c.Assert(p.Parse(), IsNil)
+	dumped := p.Dump()
+
+	expected := NewParser([]byte(second))
+	c.Assert(expected.Parse(), IsNil)
+
+	p.Reset([]byte(second))
+	c.Assert(p.Parse(), IsNil)
+	c.Assert(p.Dump(), DeepEquals, expected.Dump())
+	c.Assert(dumped["warnings"], DeepEquals, []string{ErrDayInvalid.Error()})
+	c.Assert(dumped["structured_data_elements"], HasLen, 1)
+
+	p.Strict(true)
+	p.Reset([]byte(first))
+	c.Assert(errors.Is(p.Parse(), ErrDayInvalid), Equals, true)
+}
+
+func (s *Rfc5424TestSuite) TestParseTimestamp_NoAllocation(c *C) {
+	p := NewParser([]byte("2003-08-24T05:14:15.000003-07:00 "))
+	allocs := testing.AllocsPerRun(100, func() {
+		p.Reset(p.buff)
+		p.parseTimestamp()
+	})
+
+	c.Assert(allocs, Equals, 0.0)
+}
+
 func (s *Rfc5424TestSuite) TestParser_Truncated(c *C) {
 	msg := "<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts."
 	for i := range msg {
@@ -145,6 +197,93 @@ func (s *Rfc5424TestSuite) TestParser_Truncated(c *C) {
 	}
 }
 
+func (s *Rfc5424TestSuite) TestParser_FieldErrors(c *C) {
+	for _, t := range []struct {
+		msg    string
+		err    error
+		field  string
+		offset int
+	}{
+		{"<165 1 2003-10-11T22:14:15.003Z host app 12 ID47 - msg", syslogparser.ErrPriorityNonDigit, syslogparser.FieldPriority, 0},
+		{"<165>1 2003-13-11T22:14:15.003Z host app 12 ID47 - msg", ErrMonthInvalid, syslogparser.FieldTimestamp, 14},
+		{"<165>1 2003-10-11T22:14:15.003Z host app 12 ID47 [id@1 a=b msg", ErrInvalidSDParam, syslogparser.FieldStructuredData, 49},
+	} {
+		err := NewParser([]byte(t.msg)).Parse()
+		c.Check(errors.Is(err, t.err), Equals, true, Commentf("%q", t.msg))
+
+		var fieldErr *syslogparser.FieldError
+		c.Assert(errors.As(err, &fieldErr), Equals, true, Commentf("%q", t.msg))
+		c.Check(fieldErr.Field, Equals, t.field, Commentf("%q", t.msg))
+		c.Check(fieldErr.Offset, Equals, t.offset, Commentf("%q", t.msg))
+	}
+}
+
+func (s *Rfc5424TestSuite) TestParser_Deviations(c *C) {
+	for _, t := range []struct {
+		msg string
+		err error
+	}{
+		{"<192>1 2003-10-11T22:14:15.003Z host app 12 ID47 - msg", ErrInvalidPriority},
+		{"<34>2 2003-10-11T22:14:15.003Z host app 12 ID47 - msg", ErrInvalidVersion},
+		{"<34>10 2003-10-11T22:14:15.003Z host app 12 ID47 - msg", syslogparser.ErrNoSpace},
+		{"<34>1 2003-02-29T22:14:15.003Z host app 12 ID47 - msg", ErrDayInvalid},
+		{"<34>1 2003-04-31T22:14:15.003Z host app 12 ID47 - msg", ErrDayInvalid},
+		{"<34>1 2003-10-11T22:14:15.003Zhost app 12 ID47 - msg", syslogparser.ErrNoSpace},
+		{"<34>1 2003-10-11T22:14:15.003Z h\xc3\xb4st app 12 ID47 - msg", ErrInvalidHostname},
+		{"<34>1 2003-10-11T22:14:15.003Z host \x01app 12 ID47 - msg", ErrInvalidAppName},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12\x7f ID47 - msg", ErrInvalidProcId},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12 ID47\xff - msg", ErrInvalidMsgId},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12 0123456789012345678901234567890123456789 - msg", ErrInvalidMsgId},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12 ID47 [id@1 a=\"b\"]msg", syslogparser.ErrNoSpace},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12 ID47 [id@1 a=\"b\"c=\"d\"] msg", syslogparser.ErrNoSpace},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12 ID47 [id@1 a=\"b\"  c=\"d\"] msg", ErrInvalidSDParam},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12 ID47 [id@1 a=\"b\" ] msg", ErrInvalidSDParam},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12 ID47 [id@1 a= \"b\"] msg", ErrInvalidSDParam},
+		{"<34>1 2003-10-11T22:14:15.003Z host app 12 ID47 [id@1 a=\"[b]\"] msg", ErrInvalidSDParam},
+	} {
+		strict := NewParser([]byte(t.msg))
+		strict.Strict(true)
+		c.Check(errors.Is(strict.Parse(), t.err), Equals, true, Commentf("%q", t.msg))
+
+		lenient := NewParser([]byte(t.msg))
+		lenient.Parse()
+		c.Check(lenient.Dump()["warnings"], DeepEquals, []string{t.err.Error()}, Commentf("%q", t.msg))
+	}
+}
+
+func (s *Rfc5424TestSuite) TestParser_TimestampDeviations(c *C) {
+	for _, t := range []struct {
+		msg string
+		err error
+	}{
+		{"<34>1 2003-10-11T22:14:15.Z host app 12 ID47 - msg", ErrSecFracInvalid},
+		{"<34>1 2003-10-11T22:14:15", ErrTimeZoneInvalid},
+	} {
+		// The errors of the time are reported as an unknown format
+		strict := NewParser([]byte(t.msg))
+		strict.Strict(true)
+		c.Check(errors.Is(strict.Parse(), syslogparser.ErrTimestampUnknownFormat), Equals, true, Commentf("%q", t.msg))
+
+		lenient := NewParser([]byte(t.msg))
+		lenient.Parse()
+		c.Check(lenient.warnings, HasLen, 1, Commentf("%q", t.msg))
+		c.Check(lenient.warnings[0], Equals, t.err.Error(), Commentf("%q", t.msg))
+	}
+}
+
+func (s *Rfc5424TestSuite) TestParser_NoDeviation(c *C) {
+	for _, msg := range []string{
+		"<191>1 2004-02-29T22:14:15.003Z host app 12 ID47 - msg",
+		"<0>1 2003-10-11T22:14:15.003Z - - - - -",
+	} {
+		p := NewParser([]byte(msg))
+		p.Strict(true)
+		c.Check(p.Parse(), IsNil, Commentf("%q", msg))
+		_, ok := p.Dump()["warnings"]
+		c.Check(ok, Equals, false)
+	}
+}
+
 func (s *Rfc5424TestSuite) TestParseHeader_Valid(c *C) {
 	ts := time.Date(2003, time.October, 11, 22, 14, 15, 3*10e5, time.UTC)
 	tsString := "2003-10-11T22:14:15.003Z"
@@ -584,14 +723,12 @@ func (s *Rfc5424TestSuite) TestParseNumericalTimeOffset_Valid(c *C) {
 }
 
 func (s *Rfc5424TestSuite) TestParseTimeOffset_Valid(c *C) {
-	buff := []byte("Z")
-	cursor := 0
-	l := len(buff)
+	p := NewParser([]byte("Z"))
 
-	obtained, err := parseTimeOffset(buff, &cursor, l)
+	obtained, err := p.parseTimeOffset()
 	c.Assert(err, IsNil)
 	c.Assert(obtained, DeepEquals, time.UTC)
-	c.Assert(cursor, Equals, 1)
+	c.Assert(p.cursor, Equals, 1)
 }
 
 func (s *Rfc5424TestSuite) TestGetHourMin_Valid(c *C) {
@@ -612,10 +749,9 @@ func (s *Rfc5424TestSuite) TestGetHourMin_Valid(c *C) {
 
 func (s *Rfc5424TestSuite) TestParsePartialTime_Valid(c *C) {
 	buff := []byte("05:14:15.000003")
-	cursor := 0
-	l := len(buff)
+	p := NewParser(buff)
 
-	obtained, err := parsePartialTime(buff, &cursor, l)
+	obtained, err := p.parsePartialTime()
 	expected := partialTime{
 		hour:    5,
 		minute:  14,
@@ -625,19 +761,17 @@ func (s *Rfc5424TestSuite) TestParsePartialTime_Valid(c *C) {
 
 	c.Assert(err, IsNil)
 	c.Assert(obtained, DeepEquals, expected)
-	c.Assert(cursor, Equals, l)
+	c.Assert(p.cursor, Equals, len(buff))
 }
 
 func (s *Rfc5424TestSuite) TestParseFullTime_Valid(c *C) {
 	tz := "-02:00"
-	buff := []byte("05:14:15.000003" + tz)
-	cursor := 0
-	l := len(buff)
+	p := NewParser([]byte("05:14:15.000003" + tz))
 
 	tmpTs, err := time.Parse("-07:00", string(tz))
 	c.Assert(err, IsNil)
 
-	obtainedFt, err := parseFullTime(buff, &cursor, l)
+	obtainedFt, err := p.parseFullTime()
 	expectedFt := fullTime{
 		pt: partialTime{
 			hour:    5,
@@ -650,7 +784,7 @@ func (s *Rfc5424TestSuite) TestParseFullTime_Valid(c *C) {
 
 	c.Assert(err, IsNil)
 	c.Assert(obtainedFt, DeepEquals, expectedFt)
-	c.Assert(cursor, Equals, 21)
+	c.Assert(p.cursor, Equals, 21)
 }
 
 func (s *Rfc5424TestSuite) TestToNSec(c *C) {
@@ -749,6 +883,115 @@ func (s *Rfc5424TestSuite) TestParseStructuredData_MultipleStructuredDataInvalid
 	s.assertParseSdName(c, a, buff, len(a), nil)
 }
 
+func (s *Rfc5424TestSuite) TestParseStructuredDataElements_Escaped(c *C) {
+	sdData := `[origin@32473 ip="192.0.2.1" software="a \"quoted\" [name\]" path="C:\\tmp" other="\n"][meta sequenceId="1"]`
+	p := NewParser([]byte(sdData + " message"))
+	p.Strict(true)
+
+	elements, raw, err := p.parseStructuredData()
+	c.Assert(err, IsNil)
+	c.Assert(raw, Equals, sdData)
+	c.Assert(p.cursor, Equals, len(sdData))
+	c.Assert(elements, DeepEquals, []syslogparser.SDElement{
+		{ID: "origin@32473", Params: []syslogparser.SDParam{
+			{Name: "ip", Value: "192.0.2.1"},
+			{Name: "software", Value: `a "quoted" [name]`},
+			{Name: "path", Value: `C:\tmp`},
+			{Name: "other", Value: `\n`},
+		}},
+		{ID: "meta", Params: []syslogparser.SDParam{{Name: "sequenceId", Value: "1"}}},
+	})
+
+	value, ok := elements[0].Param("software")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, Equals, `a "quoted" [name]`)
+}
+
+func (s *Rfc5424TestSuite) TestParseStructuredDataElements_BracketInValue(c *C) {
+	sdData := `[exampleSDID@32473 a="x] y"]`
+	p := NewParser([]byte(sdData + " message"))
+
+	elements, raw, err := p.parseStructuredData()
+	c.Assert(err, IsNil)
+	c.Assert(raw, Equals, sdData)
+	c.Assert(elements[0].Params, DeepEquals, []syslogparser.SDParam{{Name: "a", Value: "x] y"}})
+	c.Assert(p.warnings, DeepEquals, []string{ErrInvalidSDParam.Error()})
+}
+
+func (s *Rfc5424TestSuite) TestParseStructuredDataElements_NoParams(c *C) {
+	p := NewParser([]byte(`[timeQuality]`))
+	p.Strict(true)
+
+	elements, _, err := p.parseStructuredData()
+	c.Assert(err, IsNil)
+	c.Assert(elements, DeepEquals, []syslogparser.SDElement{{ID: "timeQuality"}})
+}
+
+func (s *Rfc5424TestSuite) TestParseStructuredDataElements_Invalid(c *C) {
+	fixtures := []string{
+		`[`,
+		`[]`,
+		`[id`,
+		`[id a]`,
+		`[id a=1]`,
+		`[id a="1]`,
+		`[id 0123456789012345678901234567890123="1"]`,
+	}
+
+	for _, fixture := range fixtures {
+		p := NewParser([]byte(fixture))
+		p.Strict(true)
+
+		elements, raw, err := p.parseStructuredData()
+		c.Assert(err, NotNil, Commentf(fixture))
+		c.Assert(elements, IsNil)
+		c.Assert(raw, Equals, "")
+		c.Assert(p.cursor, Equals, 0)
+	}
+}
+
+func (s *Rfc5424TestSuite) TestParseStructuredDataElements_RawFallback(c *C) {
+	for _, t := range []struct {
+		fixture string
+		raw     string
+		err     error
+	}{
+		{`[exampleSDID@32473 iut=3] msg`, `[exampleSDID@32473 iut=3]`, ErrInvalidSDParam},
+		{`[id a="1"][id b=2 c="]"] msg`, `[id a="1"][id b=2 c="]"]`, ErrInvalidSDParam},
+		{`[id  a=1] msg`, `[id  a=1]`, ErrInvalidSDParam},
+		{`[] msg`, `[]`, ErrInvalidSDName},
+	} {
+		p := NewParser([]byte(t.fixture))
+
+		elements, raw, err := p.parseStructuredData()
+		c.Assert(err, IsNil, Commentf(t.fixture))
+		c.Assert(elements, IsNil)
+		c.Assert(raw, Equals, t.raw)
+		c.Assert(p.cursor, Equals, len(t.raw))
+		c.Assert(p.warnings, DeepEquals, []string{t.err.Error()}, Commentf(t.fixture))
+	}
+
+	// Without a "]" followed by a space or the end the message still fails
+	p := NewParser([]byte(`[id a=1 msg`))
+	_, _, err := p.parseStructuredData()
+	c.Assert(err, Equals, ErrInvalidSDParam)
+}
+
+func (s *Rfc5424TestSuite) TestParser_UnquotedParamValue(c *C) {
+	p := NewParser([]byte(`<165>1 2003-10-11T22:14:15.003Z host app 12 ID47 [exampleSDID@32473 iut=3] msg`))
+	c.Assert(p.Parse(), IsNil)
+
+	logParts := p.Dump()
+	c.Check(logParts["structured_data"], Equals, `[exampleSDID@32473 iut=3]`)
+	c.Check(logParts["structured_data_elements"], IsNil)
+	c.Check(logParts["message"], Equals, "msg")
+	c.Check(logParts["warnings"], DeepEquals, []string{ErrInvalidSDParam.Error()})
+
+	p = NewParser([]byte(`<165>1 2003-10-11T22:14:15.003Z host app 12 ID47 [exampleSDID@32473 iut=3] msg`))
+	p.Strict(true)
+	c.Assert(errors.Is(p.Parse(), ErrInvalidSDParam), Equals, true)
+}
+
 // -------------
 
 func (s *Rfc5424TestSuite) BenchmarkParseTimestamp(c *C) {
@@ -892,10 +1135,10 @@ func (s *Rfc5424TestSuite) assertParseMsgId(c *C, msgId string, b []byte, expC i
 }
 
 func (s *Rfc5424TestSuite) assertParseSdName(c *C, sdData string, b []byte, expC int, e error) {
-	cursor := 0
-	obtained, err := parseStructuredData(b, &cursor, len(b))
+	p := NewParser(b)
+	_, obtained, err := p.parseStructuredData()
 
 	c.Assert(err, Equals, e)
 	c.Assert(obtained, Equals, sdData)
-	c.Assert(cursor, Equals, expC)
+	c.Assert(p.cursor, Equals, expC)
 }
@@ -2,8 +2,6 @@ package syslogparser
 
 import (
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -42,6 +40,62 @@ type ParserError struct {
 	ErrorString string
 }
 
+// Fields of the messages, as named in the LogParts
+const (
+	FieldPriority       = "priority"
+	FieldVersion        = "version"
+	FieldTimestamp      = "timestamp"
+	FieldHostname       = "hostname"
+	FieldTag            = "tag"
+	FieldAppName        = "app_name"
+	FieldProcId         = "proc_id"
+	FieldMsgId          = "msg_id"
+	FieldStructuredData = "structured_data"
+	FieldContent        = "content"
+)
+
+// Bytes of the message shown on each side of the offset of a FieldError
+const excerptRadius = 16
+
+// A parse error located in the message: the field being parsed, the byte
+// offset where the parser stopped and the bytes around it. It unwraps to the
+// sentinel error, like ErrPriorityNoEnd, so errors.Is keeps working
+type FieldError struct {
+	Err     error
+	Field   string
+	Offset  int
+	Excerpt string
+}
+
+// Locates the error err, found while parsing the given field of buff
+func NewFieldError(err error, field string, buff []byte, offset int) *FieldError {
+	from, to := offset-excerptRadius, offset+excerptRadius
+	if from < 0 {
+		from = 0
+	}
+	if to > len(buff) {
+		to = len(buff)
+	}
+	if from > to {
+		from = to
+	}
+
+	return &FieldError{
+		Err:     err,
+		Field:   field,
+		Offset:  offset,
+		Excerpt: string(buff[from:to]),
+	}
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%v: %s at offset %d near %q", e.Err, e.Field, e.Offset, e.Excerpt)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
 type Priority struct {
 	P int
 	F Facility
@@ -58,6 +112,29 @@ type Severity struct {
 
 type LogParts map[string]interface{}
 
+// An RFC5424 SD-ELEMENT, params are kept in the order they were sent
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+// An RFC5424 SD-PARAM, the value is already unescaped
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// Returns the value of the first param with the given name
+func (e SDElement) Param(name string) (string, bool) {
+	for _, param := range e.Params {
+		if param.Name == name {
+			return param.Value, true
+		}
+	}
+
+	return "", false
+}
+
 // https://tools.ietf.org/html/rfc3164#section-4.1
 func ParsePriority(buff []byte, cursor *int, l int) (Priority, error) {
 	pri := newPriority(0)
@@ -90,12 +167,7 @@ func ParsePriority(buff []byte, cursor *int, l int) (Priority, error) {
 		}
 
 		if IsDigit(c) {
-			v, e := strconv.Atoi(string(c))
-			if e != nil {
-				return pri, e
-			}
-
-			priDigit = (priDigit * 10) + v
+			priDigit = (priDigit * 10) + int(c-'0')
 		} else {
 			return pri, ErrPriorityNonDigit
 		}
@@ -120,19 +192,31 @@ func ParseVersion(buff []byte, cursor *int, l int) (int, error) {
 		return NO_VERSION, nil
 	}
 
-	v, e := strconv.Atoi(string(c))
-	if e != nil {
-		*cursor--
-		return NO_VERSION, e
-	}
-
-	return v, nil
+	return int(c - '0'), nil
 }
 
 func IsDigit(c byte) bool {
 	return c >= '0' && c <= '9'
 }
 
+// Returns the value of the given decimal digits, without allocating, false if
+// there is none or a byte is not a digit
+func ParseDigits(digits []byte) (int, bool) {
+	if len(digits) == 0 {
+		return 0, false
+	}
+
+	v := 0
+	for _, c := range digits {
+		if !IsDigit(c) {
+			return 0, false
+		}
+		v = v*10 + int(c-'0')
+	}
+
+	return v, true
+}
+
 func newPriority(p int) Priority {
 	// The Priority value is calculated by first multiplying the Facility
 	// number by 8 and then adding the numerical value of the Severity.
@@ -164,12 +248,11 @@ func Parse2Digits(buff []byte, cursor *int, l int, min int, max int, e error) (i
 		return 0, ErrEOL
 	}
 
-	sub := string(buff[*cursor : *cursor+digitLen])
+	i, ok := ParseDigits(buff[*cursor : *cursor+digitLen])
 
 	*cursor += digitLen
 
-	i, err := strconv.Atoi(sub)
-	if err != nil {
+	if !ok {
 		return 0, e
 	}
 
@@ -202,12 +285,6 @@ func ParseHostname(buff []byte, cursor *int, l int) (string, error) {
 	return string(hostname), nil
 }
 
-func ShowCursorPos(buff []byte, cursor int) {
-	fmt.Println(string(buff))
-	padding := strings.Repeat("-", cursor)
-	fmt.Println(padding + "↑\n")
-}
-
 func (err *ParserError) Error() string {
 	return err.ErrorString
 }
@@ -123,6 +123,55 @@ func (s *CommonTestSuite) TestParseHostname_Valid(c *C) {
 	s.assertHostname(c, hostname, buff, start, len(hostname), nil)
 }
 
+func (s *CommonTestSuite) TestParseDigits(c *C) {
+	for _, t := range []struct {
+		digits string
+		value  int
+		ok     bool
+	}{
+		{"0", 0, true},
+		{"07", 7, true},
+		{"2003", 2003, true},
+		{"", 0, false},
+		{"+1", 0, false},
+		{"1a", 0, false},
+	} {
+		value, ok := ParseDigits([]byte(t.digits))
+		c.Check(value, Equals, t.value, Commentf("%q", t.digits))
+		c.Check(ok, Equals, t.ok, Commentf("%q", t.digits))
+	}
+}
+
+func (s *CommonTestSuite) TestParsePriority_NoAllocation(c *C) {
+	buff := []byte("<165>1")
+	allocs := testing.AllocsPerRun(100, func() {
+		cursor := 0
+		ParsePriority(buff, &cursor, len(buff))
+		ParseVersion(buff, &cursor, len(buff))
+	})
+
+	c.Assert(allocs, Equals, 0.0)
+}
+
+func (s *CommonTestSuite) TestNewFieldError(c *C) {
+	buff := []byte("<34>1 2003-13-11T22:14:15.003Z mymachine.example.com su - ID47 - msg")
+
+	err := NewFieldError(ErrTimestampUnknownFormat, FieldTimestamp, buff, 40)
+	c.Assert(err.Field, Equals, FieldTimestamp)
+	c.Assert(err.Offset, Equals, 40)
+	c.Assert(err.Excerpt, Equals, "5.003Z mymachine.example.com su ")
+	c.Assert(err.Unwrap(), Equals, ErrTimestampUnknownFormat)
+	c.Assert(err.Error(), Equals, `Timestamp format unknown: timestamp at offset 40 near "5.003Z mymachine.example.com su "`)
+}
+
+func (s *CommonTestSuite) TestNewFieldError_Bounds(c *C) {
+	buff := []byte("<34>1 2003")
+
+	c.Assert(NewFieldError(ErrEOL, FieldVersion, buff, 4).Excerpt, Equals, "<34>1 2003")
+	c.Assert(NewFieldError(ErrEOL, FieldTimestamp, buff, 10).Excerpt, Equals, "<34>1 2003")
+	c.Assert(NewFieldError(ErrEOL, FieldTimestamp, buff, 40).Excerpt, Equals, "")
+}
+
 func (s *CommonTestSuite) BenchmarkParsePriority(c *C) {
 	buff := []byte("<190>")
 	var start int
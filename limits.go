@@ -0,0 +1,156 @@
+package syslog
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reported, with OpLimit, for the connections refused or closed by a limit
+var (
+	ErrTooManyConnections      = errors.New("too many connections")
+	ErrTooManyConnectionsPerIP = errors.New("too many connections from the same IP")
+	ErrIdleTimeout             = errors.New("connection idle for too long")
+	ErrConnectionLifetime      = errors.New("connection lifetime exceeded")
+)
+
+//Sets the maximum number of TCP/TLS connections, over it the new connections
+//are closed as soon as accepted. Zero, the default, means no limit
+func (s *Server) SetMaxConnections(max int) {
+	s.maxConnections = max
+}
+
+//Sets the maximum number of TCP/TLS connections from a given IP address, over
+//it the new connections are closed as soon as accepted. Zero, the default,
+//means no limit
+func (s *Server) SetMaxConnectionsPerIP(max int) {
+	s.maxConnectionsPerIP = max
+}
+
+//Sets how long a connection may go without receiving any byte before being
+//closed. Unlike SetTimeout, which bounds the time to receive a whole frame, a
+//slow but steady peer is not affected
+func (s *Server) SetIdleTimeout(timeout time.Duration) {
+	s.idleTimeout = timeout
+}
+
+//Sets how long a connection may last, it is closed once the frames received
+//before have been handled
+func (s *Server) SetMaxConnectionLifetime(lifetime time.Duration) {
+	s.maxConnectionLifetime = lifetime
+}
+
+// Accounts a newly accepted connection, returns false if it is over a limit
+// in which case it was closed and reported
+func (s *Server) admit(connection net.Conn, src *source) bool {
+	if s.maxConnections <= 0 && s.maxConnectionsPerIP <= 0 {
+		return true
+	}
+
+	ip := ""
+	if addr, ok := connection.RemoteAddr().(*net.TCPAddr); ok {
+		ip = addr.IP.String()
+	}
+
+	s.connectionsMutex.Lock()
+	var err error
+	switch {
+	case s.maxConnections > 0 && len(s.admitted) >= s.maxConnections:
+		err = ErrTooManyConnections
+		atomic.AddUint64(&src.rejected, 1)
+	case s.maxConnectionsPerIP > 0 && ip != "" && s.connectionsPerIP[ip] >= s.maxConnectionsPerIP:
+		err = ErrTooManyConnectionsPerIP
+		atomic.AddUint64(&src.rejectedPerIP, 1)
+	default:
+		s.admitted[connection] = ip
+		s.connectionsPerIP[ip]++
+	}
+	s.connectionsMutex.Unlock()
+
+	if err != nil {
+		connection.Close()
+		s.reportTransportError(err, OpLimit, connection.RemoteAddr().String(), src)
+		return false
+	}
+
+	return true
+}
+
+// Releases a connection accounted by admit, if it was
+func (s *Server) release(connection net.Conn) {
+	if c, ok := connection.(*limitedConn); ok {
+		connection = c.Conn
+	}
+
+	s.connectionsMutex.Lock()
+	defer s.connectionsMutex.Unlock()
+
+	ip, ok := s.admitted[connection]
+	if !ok {
+		return
+	}
+
+	delete(s.admitted, connection)
+	if s.connectionsPerIP[ip]--; s.connectionsPerIP[ip] <= 0 {
+		delete(s.connectionsPerIP, ip)
+	}
+}
+
+// Wraps the connection enforcing the idle timeout and maximum lifetime, if
+// any is set
+func (s *Server) limitConnection(connection net.Conn) net.Conn {
+	if s.idleTimeout <= 0 && s.maxConnectionLifetime <= 0 {
+		return connection
+	}
+
+	c := &limitedConn{Conn: connection, idleTimeout: s.idleTimeout}
+	if s.maxConnectionLifetime > 0 {
+		c.expires = time.Now().Add(s.maxConnectionLifetime)
+	}
+
+	return c
+}
+
+// A connection whose read deadline is the earliest of the one set by the
+// server, the idle timeout and the end of its lifetime. The reads which time
+// out because of the last two return ErrIdleTimeout or ErrConnectionLifetime.
+type limitedConn struct {
+	net.Conn
+	idleTimeout time.Duration
+	expires     time.Time
+
+	mutex    sync.Mutex
+	deadline time.Time
+}
+
+func (c *limitedConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.deadline = t
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *limitedConn) Read(b []byte) (int, error) {
+	c.mutex.Lock()
+	deadline, limit := c.deadline, error(nil)
+	if c.idleTimeout > 0 {
+		if idle := time.Now().Add(c.idleTimeout); deadline.IsZero() || idle.Before(deadline) {
+			deadline, limit = idle, ErrIdleTimeout
+		}
+	}
+	if !c.expires.IsZero() && (deadline.IsZero() || c.expires.Before(deadline)) {
+		deadline, limit = c.expires, ErrConnectionLifetime
+	}
+	c.Conn.SetReadDeadline(deadline)
+	c.mutex.Unlock()
+
+	n, err := c.Conn.Read(b)
+	if err, ok := err.(net.Error); ok && err.Timeout() && limit != nil {
+		return n, limit
+	}
+
+	return n, err
+}
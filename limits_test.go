@@ -0,0 +1,182 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/internal/testcert"
+)
+
+type LimitsSuite struct{}
+
+var _ = Suite(&LimitsSuite{})
+
+func (s *LimitsSuite) server(c *C, configure func(*Server)) (*Server, *handlerRecorder, *errorRecorder) {
+	handler := new(handlerRecorder)
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetTransportErrorHandler(recorder.transportError)
+	configure(server)
+	c.Assert(server.ListenTCP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	return server, handler, recorder
+}
+
+func dial(c *C, server *Server) net.Conn {
+	conn, err := net.Dial("tcp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	time.Sleep(20 * time.Millisecond)
+
+	return conn
+}
+
+// Waits for the peer to close the connection
+func closedByPeer(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	return err == io.EOF
+}
+
+func (s *LimitsSuite) TestMaxConnections(c *C) {
+	server, _, recorder := s.server(c, func(server *Server) {
+		server.SetMaxConnections(1)
+	})
+	defer server.Kill()
+
+	first := dial(c, server)
+	defer first.Close()
+	second := dial(c, server)
+	defer second.Close()
+	c.Check(closedByPeer(second), Equals, true)
+
+	first.Close()
+	time.Sleep(20 * time.Millisecond)
+	third := dial(c, server)
+	defer third.Close()
+	third.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err := third.Read(make([]byte, 1))
+	c.Check(err.(net.Error).Timeout(), Equals, true)
+	server.Kill()
+	server.Wait()
+
+	c.Check(server.Stats().Listeners[0].Rejected, Equals, uint64(1))
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpLimit)
+	c.Check(recorder.transportErrors[0].Err, Equals, ErrTooManyConnections)
+}
+
+func (s *LimitsSuite) TestMaxConnectionsPerIP(c *C) {
+	server, _, recorder := s.server(c, func(server *Server) {
+		server.SetMaxConnectionsPerIP(2)
+	})
+	defer server.Kill()
+
+	for i := 0; i < 2; i++ {
+		conn := dial(c, server)
+		defer conn.Close()
+	}
+	third := dial(c, server)
+	defer third.Close()
+	c.Check(closedByPeer(third), Equals, true)
+	server.Kill()
+	server.Wait()
+
+	c.Check(server.Stats().Listeners[0].RejectedPerIP, Equals, uint64(1))
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Err, Equals, ErrTooManyConnectionsPerIP)
+}
+
+func (s *LimitsSuite) TestIdleTimeout(c *C) {
+	server, handler, recorder := s.server(c, func(server *Server) {
+		server.SetIdleTimeout(50 * time.Millisecond)
+	})
+	defer server.Kill()
+
+	conn := dial(c, server)
+	defer conn.Close()
+	conn.Write([]byte(exampleSyslog + "\n"))
+	c.Check(closedByPeer(conn), Equals, true)
+	server.Kill()
+	server.Wait()
+
+	c.Check(handler.logParts, HasLen, 1)
+	c.Check(server.Stats().Listeners[0].IdleClosed, Equals, uint64(1))
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpLimit)
+	c.Check(recorder.transportErrors[0].Err, Equals, ErrIdleTimeout)
+}
+
+func (s *LimitsSuite) TestIdleTimeoutSlowPeer(c *C) {
+	server, handler, recorder := s.server(c, func(server *Server) {
+		server.SetIdleTimeout(200 * time.Millisecond)
+	})
+
+	conn := dial(c, server)
+	defer conn.Close()
+	// The frame takes longer than the idle timeout, but bytes keep coming
+	for _, b := range []byte(exampleSyslog + "\n") {
+		conn.Write([]byte{b})
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Check(handler.logParts, HasLen, 1)
+	c.Check(recorder.transportErrors, HasLen, 0)
+}
+
+func (s *LimitsSuite) TestMaxConnectionLifetime(c *C) {
+	server, handler, recorder := s.server(c, func(server *Server) {
+		server.SetMaxConnectionLifetime(100 * time.Millisecond)
+	})
+	defer server.Kill()
+
+	conn := dial(c, server)
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		conn.Write([]byte(exampleSyslog + "\n"))
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Check(closedByPeer(conn), Equals, true)
+	server.Kill()
+	server.Wait()
+
+	c.Check(handler.logParts, HasLen, 3)
+	c.Check(server.Stats().Listeners[0].LifetimeClosed, Equals, uint64(1))
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Err, Equals, ErrConnectionLifetime)
+
+	var buf bytes.Buffer
+	c.Assert(WritePrometheus(&buf, server.Stats()), IsNil)
+	c.Check(buf.String(), Matches, `(?s).*syslog_connections_limit_closed_total\{listener="[^"]+",transport="tcp",reason="lifetime"\} 1\n.*`)
+}
+
+func (s *LimitsSuite) TestHandshakeTimeout(c *C) {
+	certificate := testcert.SelfSigned(c, "logs.example.com")
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(new(handlerRecorder))
+	server.SetTransportErrorHandler(recorder.transportError)
+	server.SetIdleTimeout(50 * time.Millisecond)
+	c.Assert(server.ListenTCPTLS("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}}), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	// A peer which never starts the handshake is not waited for forever
+	conn := dial(c, server)
+	defer conn.Close()
+	c.Check(closedByPeer(conn), Equals, true)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpHandshake)
+}
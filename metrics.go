@@ -0,0 +1,402 @@
+package syslog
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// Upper bounds of the handler latency histogram buckets
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Counters of a listener at a given time
+type ListenerStats struct {
+	// The name of the listener, its address unless named by SetListenerName
+	// or systemd
+	Listener    string
+	Transport   string
+	Datagrams   uint64
+	Connections uint64
+	Bytes       uint64
+	Dropped     uint64
+	Overflowed  uint64
+	// Connections refused over the maximum, overall and per IP, and closed
+	// by the idle timeout and maximum lifetime
+	Rejected       uint64
+	RejectedPerIP  uint64
+	IdleClosed     uint64
+	LifetimeClosed uint64
+	// Connections and datagrams refused by the access lists
+	Denied  uint64
+	Formats []FormatStats
+}
+
+// Counters of the messages of a given format received on a listener
+type FormatStats struct {
+	Format         string
+	Messages       uint64
+	ParseErrors    uint64
+	HandlerLatency HistogramStats
+}
+
+// Distribution of durations, the bucket counts are cumulative
+type HistogramStats struct {
+	Count   uint64
+	Sum     time.Duration
+	Buckets []BucketStats
+}
+
+type BucketStats struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// Snapshot of the server counters, ordered by listener and format
+type Stats struct {
+	Listeners []ListenerStats
+}
+
+// Where the messages come from, every message received on a listener is
+// accounted in its source
+type source struct {
+	listener  string
+	transport string
+	address   string
+	// Set by SetListenerName, while the server runs too
+	label       atomic.Value
+	datagrams   uint64
+	connections uint64
+	bytes       uint64
+	dropped     uint64
+	overflowed  uint64
+	// Connections refused or closed by the limits
+	rejected       uint64
+	rejectedPerIP  uint64
+	idleClosed     uint64
+	lifetimeClosed uint64
+	// Connections and datagrams refused by the access lists
+	denied     uint64
+	accessList atomic.Value
+	// Set by SetListenerRateLimit
+	rateLimiter *rateLimiter
+	mutex       sync.Mutex
+	formats     map[string]*formatCounters
+	// Set on RFC5425 listeners
+	rfc5425 bool
+	peers   *peerAuthorizer
+	// Set on RELP listeners
+	relp bool
+	// Set on unix listeners opened with SetPeerCredentials
+	credentials bool
+	// Set on TCP and TLS listeners opened with SetProxyProtocol
+	proxy *proxyProtocol
+}
+
+type formatCounters struct {
+	messages    uint64
+	parseErrors uint64
+	latencySum  int64
+	latency     []uint64
+}
+
+type metrics struct {
+	mutex   sync.Mutex
+	sources []*source
+}
+
+func (m *metrics) get(listener, transport string) *source {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, src := range m.sources {
+		if src.listener == listener && src.transport == transport {
+			return src
+		}
+	}
+
+	src := &source{
+		listener:  listener,
+		transport: transport,
+		address:   listener,
+		formats:   make(map[string]*formatCounters),
+	}
+	src.setName(listener)
+	m.sources = append(m.sources, src)
+
+	return src
+}
+
+func (m *metrics) snapshot() Stats {
+	m.mutex.Lock()
+	sources := append([]*source(nil), m.sources...)
+	m.mutex.Unlock()
+
+	var stats Stats
+	for _, src := range sources {
+		stats.Listeners = append(stats.Listeners, src.snapshot())
+	}
+
+	sort.Slice(stats.Listeners, func(i, j int) bool {
+		a, b := stats.Listeners[i], stats.Listeners[j]
+		if a.Listener != b.Listener {
+			return a.Listener < b.Listener
+		}
+		return a.Transport < b.Transport
+	})
+
+	return stats
+}
+
+// Returns the name labelling the messages, counters and errors of the source
+func (src *source) name() string {
+	return src.label.Load().(string)
+}
+
+func (src *source) setName(name string) {
+	src.label.Store(name)
+}
+
+func (src *source) format(name string) *formatCounters {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+
+	counters, ok := src.formats[name]
+	if !ok {
+		counters = &formatCounters{latency: make([]uint64, len(latencyBuckets))}
+		src.formats[name] = counters
+	}
+
+	return counters
+}
+
+func (src *source) snapshot() ListenerStats {
+	stats := ListenerStats{
+		Listener:    src.name(),
+		Transport:   src.transport,
+		Datagrams:   atomic.LoadUint64(&src.datagrams),
+		Connections: atomic.LoadUint64(&src.connections),
+		Bytes:       atomic.LoadUint64(&src.bytes),
+		Dropped:     atomic.LoadUint64(&src.dropped),
+		Overflowed:  atomic.LoadUint64(&src.overflowed),
+
+		Rejected:       atomic.LoadUint64(&src.rejected),
+		RejectedPerIP:  atomic.LoadUint64(&src.rejectedPerIP),
+		IdleClosed:     atomic.LoadUint64(&src.idleClosed),
+		LifetimeClosed: atomic.LoadUint64(&src.lifetimeClosed),
+		Denied:         atomic.LoadUint64(&src.denied),
+	}
+
+	src.mutex.Lock()
+	for name, counters := range src.formats {
+		stats.Formats = append(stats.Formats, counters.snapshot(name))
+	}
+	src.mutex.Unlock()
+
+	sort.Slice(stats.Formats, func(i, j int) bool {
+		return stats.Formats[i].Format < stats.Formats[j].Format
+	})
+
+	return stats
+}
+
+func (c *formatCounters) observe(latency time.Duration, err error) {
+	atomic.AddUint64(&c.messages, 1)
+	if err != nil {
+		atomic.AddUint64(&c.parseErrors, 1)
+	}
+
+	atomic.AddInt64(&c.latencySum, int64(latency))
+	for i, bound := range latencyBuckets {
+		if latency <= bound {
+			atomic.AddUint64(&c.latency[i], 1)
+			break
+		}
+	}
+}
+
+func (c *formatCounters) snapshot(name string) FormatStats {
+	stats := FormatStats{
+		Format:      name,
+		Messages:    atomic.LoadUint64(&c.messages),
+		ParseErrors: atomic.LoadUint64(&c.parseErrors),
+	}
+
+	var cumulative uint64
+	for i, bound := range latencyBuckets {
+		cumulative += atomic.LoadUint64(&c.latency[i])
+		stats.HandlerLatency.Buckets = append(stats.HandlerLatency.Buckets, BucketStats{bound, cumulative})
+	}
+
+	// Messages is incremented first, so it may be ahead of the buckets
+	stats.HandlerLatency.Count = stats.Messages
+	stats.HandlerLatency.Sum = time.Duration(atomic.LoadInt64(&c.latencySum))
+
+	return stats
+}
+
+// Name of the format of a message, as used in the metrics
+func formatName(f format.Format, logParts format.LogParts) string {
+	switch f.(type) {
+	case *format.RFC3164:
+		return "rfc3164"
+	case *format.RFC5424:
+		return "rfc5424"
+	case *format.RFC6587:
+		return "rfc6587"
+	case *format.Automatic:
+		if _, ok := logParts["version"]; ok {
+			return "rfc5424"
+		}
+		return "rfc3164"
+	default:
+		return "custom"
+	}
+}
+
+//Returns a snapshot of the server counters
+func (s *Server) Stats() Stats {
+	return s.metrics.snapshot()
+}
+
+//Returns an http.Handler exposing the server counters in the Prometheus text
+//format
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, s.Stats())
+	})
+}
+
+// WritePrometheus writes the stats in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, stats Stats) error {
+	p := &prometheusWriter{w: w}
+
+	listenerCounters := []struct {
+		name  string
+		help  string
+		value func(ListenerStats) uint64
+	}{
+		{"syslog_datagrams_received_total", "Datagrams received.", func(l ListenerStats) uint64 { return l.Datagrams }},
+		{"syslog_connections_accepted_total", "Stream connections accepted.", func(l ListenerStats) uint64 { return l.Connections }},
+		{"syslog_bytes_received_total", "Bytes received, framing excluded for stream connections.", func(l ListenerStats) uint64 { return l.Bytes }},
+		{"syslog_datagrams_dropped_total", "Datagrams dropped because the queue was full.", func(l ListenerStats) uint64 { return l.Dropped }},
+		{"syslog_datagrams_overflowed_total", "Datagrams handed to the overflow function because the queue was full.", func(l ListenerStats) uint64 { return l.Overflowed }},
+		{"syslog_denied_total", "Connections and datagrams refused by the access lists.", func(l ListenerStats) uint64 { return l.Denied }},
+	}
+
+	for _, counter := range listenerCounters {
+		p.header(counter.name, counter.help, "counter")
+		for _, l := range stats.Listeners {
+			p.sample(counter.name, labels(l, ""), fmt.Sprint(counter.value(l)))
+		}
+	}
+
+	reasonCounters := []struct {
+		name   string
+		help   string
+		values func(ListenerStats) []reasonValue
+	}{
+		{"syslog_connections_rejected_total", "Stream connections closed as soon as accepted because of a limit.", func(l ListenerStats) []reasonValue {
+			return []reasonValue{{"max_connections", l.Rejected}, {"max_connections_per_ip", l.RejectedPerIP}}
+		}},
+		{"syslog_connections_limit_closed_total", "Stream connections closed by the idle timeout or maximum lifetime.", func(l ListenerStats) []reasonValue {
+			return []reasonValue{{"idle", l.IdleClosed}, {"lifetime", l.LifetimeClosed}}
+		}},
+	}
+
+	for _, counter := range reasonCounters {
+		p.header(counter.name, counter.help, "counter")
+		for _, l := range stats.Listeners {
+			for _, v := range counter.values(l) {
+				p.sample(counter.name, labels(l, "")+`,reason="`+v.reason+`"`, fmt.Sprint(v.value))
+			}
+		}
+	}
+
+	formatCounters := []struct {
+		name  string
+		help  string
+		value func(FormatStats) uint64
+	}{
+		{"syslog_messages_total", "Messages handed to the handler.", func(f FormatStats) uint64 { return f.Messages }},
+		{"syslog_parse_errors_total", "Messages that failed to parse.", func(f FormatStats) uint64 { return f.ParseErrors }},
+	}
+
+	for _, counter := range formatCounters {
+		p.header(counter.name, counter.help, "counter")
+		for _, l := range stats.Listeners {
+			for _, f := range l.Formats {
+				p.sample(counter.name, labels(l, f.Format), fmt.Sprint(counter.value(f)))
+			}
+		}
+	}
+
+	name := "syslog_handler_duration_seconds"
+	p.header(name, "Time spent in the handler.", "histogram")
+	for _, l := range stats.Listeners {
+		for _, f := range l.Formats {
+			lbls := labels(l, f.Format)
+			for _, bucket := range f.HandlerLatency.Buckets {
+				p.sample(name+"_bucket", lbls+`,le="`+fmt.Sprint(bucket.UpperBound.Seconds())+`"`, fmt.Sprint(bucket.Count))
+			}
+			p.sample(name+"_bucket", lbls+`,le="+Inf"`, fmt.Sprint(f.HandlerLatency.Count))
+			p.sample(name+"_sum", lbls, fmt.Sprint(f.HandlerLatency.Sum.Seconds()))
+			p.sample(name+"_count", lbls, fmt.Sprint(f.HandlerLatency.Count))
+		}
+	}
+
+	return p.err
+}
+
+type reasonValue struct {
+	reason string
+	value  uint64
+}
+
+type prometheusWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *prometheusWriter) header(name, help, kind string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (p *prometheusWriter) sample(name, labels, value string) {
+	p.printf("%s{%s} %s\n", name, labels, value)
+}
+
+func (p *prometheusWriter) printf(format string, a ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, a...)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labels(l ListenerStats, formatName string) string {
+	lbls := `listener="` + labelEscaper.Replace(l.Listener) + `",transport="` + labelEscaper.Replace(l.Transport) + `"`
+	if formatName != "" {
+		lbls += `,format="` + formatName + `"`
+	}
+
+	return lbls
+}
@@ -0,0 +1,151 @@
+package syslog
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type MetricsSuite struct{}
+
+var _ = Suite(&MetricsSuite{})
+
+func (s *MetricsSuite) TestStats(c *C) {
+	handler := &handlerAtomicCounter{expected: -1}
+	server := NewServer()
+	server.SetFormat(Automatic)
+	server.SetHandler(handler)
+	c.Assert(server.ListenUDP("127.0.0.1:0"), IsNil)
+	c.Assert(server.ListenTCP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	udp, err := net.Dial("udp", server.connections[0].LocalAddr().String())
+	c.Assert(err, IsNil)
+	udp.Write([]byte(exampleSyslog))
+	udp.Write([]byte(exampleRFC5424Syslog))
+	udp.Close()
+
+	tcp, err := net.Dial("tcp", server.listeners[0].Addr().String())
+	c.Assert(err, IsNil)
+	tcp.Write([]byte(exampleRFC5424Syslog + "\n<34>1 garbage\n"))
+	tcp.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Assert(server.Shutdown(ctx), IsNil)
+
+	stats := server.Stats()
+	c.Assert(stats.Listeners, HasLen, 2)
+
+	var udpStats, tcpStats ListenerStats
+	for _, l := range stats.Listeners {
+		switch l.Transport {
+		case "udp":
+			udpStats = l
+		case "tcp":
+			tcpStats = l
+		}
+	}
+
+	c.Check(udpStats.Listener, Equals, server.connections[0].LocalAddr().String())
+	c.Check(udpStats.Datagrams, Equals, uint64(2))
+	c.Check(udpStats.Bytes, Equals, uint64(len(exampleSyslog)+len(exampleRFC5424Syslog)))
+	c.Assert(udpStats.Formats, HasLen, 2)
+	c.Check(udpStats.Formats[0].Format, Equals, "rfc3164")
+	c.Check(udpStats.Formats[0].Messages, Equals, uint64(1))
+	c.Check(udpStats.Formats[1].Format, Equals, "rfc5424")
+	c.Check(udpStats.Formats[1].Messages, Equals, uint64(1))
+	c.Check(udpStats.Formats[1].ParseErrors, Equals, uint64(0))
+	c.Check(udpStats.Formats[1].HandlerLatency.Count, Equals, uint64(1))
+
+	c.Check(tcpStats.Listener, Equals, server.listeners[0].Addr().String())
+	c.Check(tcpStats.Connections, Equals, uint64(1))
+	c.Check(tcpStats.Datagrams, Equals, uint64(0))
+	c.Assert(tcpStats.Formats, HasLen, 1)
+	c.Check(tcpStats.Formats[0].Messages, Equals, uint64(2))
+	c.Check(tcpStats.Formats[0].ParseErrors, Equals, uint64(1))
+}
+
+func (s *MetricsSuite) TestMetricsHandler(c *C) {
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(new(HandlerMock))
+	server.goParseDatagrams()
+	src := server.metrics.get("127.0.0.1:514", "udp")
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleSyslog), client: "127.0.0.1:1234", source: src}
+	close(server.datagramChannel)
+	server.Wait()
+
+	recorder := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	c.Check(recorder.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4; charset=utf-8")
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE syslog_messages_total counter",
+		`syslog_messages_total{listener="127.0.0.1:514",transport="udp",format="rfc3164"} 1`,
+		`syslog_parse_errors_total{listener="127.0.0.1:514",transport="udp",format="rfc3164"} 0`,
+		`syslog_datagrams_dropped_total{listener="127.0.0.1:514",transport="udp"} 0`,
+		"# TYPE syslog_handler_duration_seconds histogram",
+		`syslog_handler_duration_seconds_bucket{listener="127.0.0.1:514",transport="udp",format="rfc3164",le="+Inf"} 1`,
+		`syslog_handler_duration_seconds_count{listener="127.0.0.1:514",transport="udp",format="rfc3164"} 1`,
+	} {
+		c.Check(strings.Contains(body, line+"\n"), Equals, true, Commentf(line))
+	}
+}
+
+func (s *MetricsSuite) TestListenerName(c *C) {
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(new(HandlerMock))
+	c.Assert(server.ListenUDP("127.0.0.1:0"), IsNil)
+	c.Assert(server.SetListenerName("127.0.0.1:0", "local"), IsNil)
+
+	stats := server.Stats()
+	c.Assert(stats.Listeners, HasLen, 1)
+	c.Check(stats.Listeners[0].Listener, Equals, "local")
+	c.Check(server.DropStats(), DeepEquals, map[string]DropStats{"local": {}})
+
+	recorder := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	line := `syslog_datagrams_dropped_total{listener="local",transport="udp"} 0`
+	c.Check(strings.Contains(recorder.Body.String(), line+"\n"), Equals, true)
+	server.connections[0].Close()
+}
+
+func (s *MetricsSuite) TestListenerNameWhileRunning(c *C) {
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetIncludeMetadata(true)
+	c.Assert(server.ListenUDP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	udp, err := net.Dial("udp", server.connections[0].LocalAddr().String())
+	c.Assert(err, IsNil)
+	defer udp.Close()
+
+	for i := 0; i < 10; i++ {
+		udp.Write([]byte(exampleSyslog))
+		c.Assert(server.SetListenerName("127.0.0.1:0", "local"), IsNil)
+		server.Stats()
+	}
+	time.Sleep(100 * time.Millisecond)
+	udp.Write([]byte(exampleSyslog))
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Assert(server.Shutdown(ctx), IsNil)
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	c.Assert(handler.logParts, Not(HasLen), 0)
+	c.Check(handler.logParts[len(handler.logParts)-1]["listener"], Equals, "local")
+}
@@ -0,0 +1,250 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reported, with OpProxy, for the connections of trusted proxies closed as
+// their PROXY protocol header is missing or invalid
+var ErrProxyHeader = errors.New("invalid PROXY protocol header")
+
+const (
+	// The longest v1 header, "PROXY TCP6" with the longest addresses and ports
+	maxProxyV1HeaderSize = 107
+	// Time given to a trusted proxy to send its header, unless SetTimeout is
+	// shorter
+	proxyHeaderTimeout = 5 * time.Second
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// PROXY protocol settings of a listener, the TLS handshake is done once the
+// header is read
+type proxyProtocol struct {
+	trusted   []*net.IPNet
+	tlsConfig *tls.Config
+}
+
+//Enables the PROXY protocol, v1 and v2, on the TCP and TLS listeners opened
+//or added afterwards. The connections from the trusted proxies, given as
+//CIDRs or single IPs, must start with a header whose source address then
+//stands for the connection: as client, for the access lists, the connection
+//limits per IP and the rate limits. The other connections are served as usual
+func (s *Server) SetProxyProtocol(trusted []string) error {
+	var nets []*net.IPNet
+	for _, cidr := range trusted {
+		ipNet, err := parseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, ipNet)
+	}
+
+	s.proxyTrusted = nets
+	return nil
+}
+
+// Opens a TLS listener, accepting raw TCP connections when the PROXY protocol
+// is enabled as the handshake comes after the header
+func (s *Server) listenTLS(addr string, config *tls.Config) (net.Listener, *proxyProtocol, error) {
+	if s.proxyTrusted == nil {
+		listener, err := tls.Listen("tcp", addr, config)
+		return listener, nil, err
+	}
+
+	if !hasCertificates(config) {
+		return nil, nil, ErrNoCertificates
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return listener, &proxyProtocol{trusted: s.proxyTrusted, tlsConfig: config}, nil
+}
+
+// Serves TLS over a listener opened elsewhere, leaving the handshake to the
+// connections when the PROXY protocol is enabled as it comes after the header
+func (s *Server) serveTLS(listener net.Listener, config *tls.Config) (net.Listener, *proxyProtocol, error) {
+	if s.proxyTrusted == nil {
+		return tls.NewListener(listener, config), nil, nil
+	}
+
+	if !hasCertificates(config) {
+		return nil, nil, ErrNoCertificates
+	}
+
+	return listener, &proxyProtocol{trusted: s.proxyTrusted, tlsConfig: config}, nil
+}
+
+func hasCertificates(config *tls.Config) bool {
+	return config != nil && (len(config.Certificates) > 0 || config.GetCertificate != nil || config.GetConfigForClient != nil)
+}
+
+// Reads the PROXY protocol header of a connection from a trusted proxy, and
+// starts the TLS server side on TLS listeners
+func (s *Server) acceptProxy(connection net.Conn, proxy *proxyProtocol) (net.Conn, error) {
+	if addr, ok := connection.RemoteAddr().(*net.TCPAddr); ok && proxy.trusts(addr.IP) {
+		timeout := proxyHeaderTimeout
+		if s.readTimeoutMilliseconds > 0 && time.Duration(s.readTimeoutMilliseconds)*time.Millisecond < timeout {
+			timeout = time.Duration(s.readTimeoutMilliseconds) * time.Millisecond
+		}
+
+		s.setAcceptDeadline(connection, timeout)
+		reader := bufio.NewReader(connection)
+		remoteAddr, err := readProxyHeader(reader)
+		s.setAcceptDeadline(connection, 0)
+		if err != nil {
+			return connection, err
+		}
+
+		connection = &proxyConn{connection, reader, remoteAddr}
+	}
+
+	if proxy.tlsConfig != nil {
+		connection = tls.Server(connection, proxy.tlsConfig)
+	}
+
+	return connection, nil
+}
+
+func (proxy *proxyProtocol) trusts(ip net.IP) bool {
+	for _, ipNet := range proxy.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reads a v1 or v2 header, returns the source address it carries or nil if
+// the connection stands for itself, as with UNKNOWN and LOCAL
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] == proxyV2Signature[0] {
+		return readProxyV2Header(reader)
+	}
+
+	return readProxyV1Header(reader)
+}
+
+// Reads a header like "PROXY TCP4 192.0.2.1 198.51.100.1 56324 514\r\n"
+func readProxyV1Header(reader *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxProxyV1HeaderSize {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrProxyHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, ErrProxyHeader
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, ErrProxyHeader
+	}
+
+	if len(fields) != 6 {
+		return nil, ErrProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, ErrProxyHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// Reads a binary header: the signature, the version and command, the address
+// family and protocol, the length of what follows then the addresses
+func readProxyV2Header(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:12], proxyV2Signature) || header[12]>>4 != 2 {
+		return nil, ErrProxyHeader
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	switch header[12] & 0x0f {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, ErrProxyHeader
+	}
+
+	// The addresses are followed by optional TLVs, which are ignored
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, ErrProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, ErrProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// A connection from a trusted proxy, which reads what followed the header and
+// gives the source address it carried
+type proxyConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+
+	return c.Conn.RemoteAddr()
+}
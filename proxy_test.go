@@ -0,0 +1,239 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/internal/testcert"
+)
+
+type ProxySuite struct{}
+
+var _ = Suite(&ProxySuite{})
+
+// Builds a v2 header of the PROXY command for TCP over IPv4
+func proxyV2Header(src net.IP, port uint16, tlvs []byte) string {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, 0x21, 0x11, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(12+len(tlvs)))
+	header = append(header, src.To4()...)
+	header = append(header, 127, 0, 0, 1)
+	header = append(header, byte(port>>8), byte(port), 514>>8, 514&0xff)
+
+	return string(append(header, tlvs...))
+}
+
+func (s *ProxySuite) TestReadProxyHeader(c *C) {
+	for _, t := range []struct {
+		header string
+		addr   string
+		err    error
+	}{
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 514\r\n", "192.0.2.1:56324", nil},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 56324 514\r\n", "[2001:db8::1]:56324", nil},
+		{"PROXY UNKNOWN\r\n", "", nil},
+		{"PROXY UNKNOWN 192.0.2.1 198.51.100.1 56324 514\r\n", "", nil},
+		{"PROXY TCP4 2001:db8::1 2001:db8::2 56324 514\r\n", "", ErrProxyHeader},
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 65536 514\r\n", "", ErrProxyHeader},
+		{"PROXY TCP4 192.0.2.1\r\n", "", ErrProxyHeader},
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 514\n", "", ErrProxyHeader},
+		{"<34>Oct 11 22:14:15 mymachine su: content\r\n", "", ErrProxyHeader},
+		{"PROXY " + strings.Repeat("X", maxProxyV1HeaderSize) + "\r\n", "", ErrProxyHeader},
+		{proxyV2Header(net.IPv4(192, 0, 2, 1), 56324, nil), "192.0.2.1:56324", nil},
+		{proxyV2Header(net.IPv4(192, 0, 2, 1), 56324, []byte{0x04, 0, 1, 0}), "192.0.2.1:56324", nil},
+		{string(proxyV2Signature) + "\x20\x00\x00\x00", "", nil},
+		{string(proxyV2Signature) + "\x21\x00\x00\x00", "", nil},
+		{string(proxyV2Signature) + "\x22\x11\x00\x00", "", ErrProxyHeader},
+		{string(proxyV2Signature) + "\x21\x11\x00\x04\x01\x02\x03\x04", "", ErrProxyHeader},
+		{"\r\n\r\n\x00\r\nQUIX\n\x21\x11\x00\x00", "", ErrProxyHeader},
+	} {
+		addr, err := readProxyHeader(bufio.NewReader(strings.NewReader(t.header + "rest")))
+		c.Check(err, Equals, t.err, Commentf("%q", t.header))
+		if t.addr == "" {
+			c.Check(addr, IsNil, Commentf("%q", t.header))
+		} else {
+			c.Check(addr.String(), Equals, t.addr, Commentf("%q", t.header))
+		}
+	}
+}
+
+func (s *ProxySuite) serve(c *C, trusted []string, listen func(*Server) error) (*Server, *handlerRecorder, *errorRecorder) {
+	handler := new(handlerRecorder)
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetTransportErrorHandler(recorder.transportError)
+	c.Assert(server.SetProxyProtocol(trusted), IsNil)
+	c.Assert(listen(server), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	return server, handler, recorder
+}
+
+func (s *ProxySuite) TestProxiedTCP(c *C) {
+	server, handler, _ := s.serve(c, []string{"127.0.0.0/8"}, func(server *Server) error {
+		return server.ListenTCP("127.0.0.1:0")
+	})
+	c.Assert(server.SetAccessList(AccessList{Deny: []string{"192.0.2.66"}}), IsNil)
+
+	for _, header := range []string{
+		"PROXY TCP4 192.0.2.1 127.0.0.1 56324 514\r\n",
+		proxyV2Header(net.IPv4(192, 0, 2, 2), 56325, nil),
+		"PROXY TCP4 192.0.2.66 127.0.0.1 56326 514\r\n",
+	} {
+		conn := dial(c, server)
+		conn.Write([]byte(header + exampleSyslog + "\n"))
+		conn.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	var clients []string
+	for _, logParts := range handler.logParts {
+		clients = append(clients, logParts["client"].(string))
+	}
+	c.Check(clients, DeepEquals, []string{"192.0.2.1:56324", "192.0.2.2:56325"})
+	c.Check(server.Stats().Listeners[0].Denied, Equals, uint64(1))
+}
+
+func (s *ProxySuite) TestUntrusted(c *C) {
+	server, handler, _ := s.serve(c, []string{"10.0.0.0/8"}, func(server *Server) error {
+		return server.ListenTCP("127.0.0.1:0")
+	})
+
+	conn := dial(c, server)
+	conn.Write([]byte(exampleSyslog + "\n"))
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.logParts[0]["client"], Matches, `127\.0\.0\.1:.*`)
+}
+
+func (s *ProxySuite) TestMissingHeader(c *C) {
+	server, handler, recorder := s.serve(c, []string{"127.0.0.1"}, func(server *Server) error {
+		return server.ListenTCP("127.0.0.1:0")
+	})
+
+	conn := dial(c, server)
+	conn.Write([]byte(exampleSyslog + "\n"))
+	c.Check(closedByPeer(conn), Equals, true)
+	conn.Close()
+	server.Kill()
+	server.Wait()
+
+	c.Check(handler.logParts, HasLen, 0)
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpProxy)
+	c.Check(recorder.transportErrors[0].Err, Equals, ErrProxyHeader)
+}
+
+func (s *ProxySuite) TestProxiedTLS(c *C) {
+	certificate := testcert.SelfSigned(c, "logs.example.com")
+	server, handler, _ := s.serve(c, []string{"127.0.0.1"}, func(server *Server) error {
+		server.SetTlsPeerNameFunc(nil)
+		return server.ListenTCPTLS("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	})
+
+	conn := dial(c, server)
+	conn.Write([]byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 6514\r\n"))
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	_, err := tlsConn.Write([]byte(exampleSyslog + "\n"))
+	c.Assert(err, IsNil)
+	tlsConn.Close()
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.logParts[0]["client"], Equals, "192.0.2.1:56324")
+	c.Check(server.Stats().Listeners[0].Transport, Equals, "tls")
+}
+
+func (s *ProxySuite) TestSlowHeader(c *C) {
+	server, handler, _ := s.serve(c, []string{"127.0.0.1"}, func(server *Server) error {
+		return server.ListenTCP("127.0.0.1:0")
+	})
+
+	// Waiting for the header of a proxy does not hold up the others
+	slow := dial(c, server)
+	defer slow.Close()
+	slow.Write([]byte("PROXY TCP4"))
+
+	conn := dial(c, server)
+	conn.Write([]byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 514\r\n" + exampleSyslog + "\n"))
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	handler.mutex.Lock()
+	c.Check(handler.logParts, HasLen, 1)
+	handler.mutex.Unlock()
+
+	start := time.Now()
+	server.Kill()
+	server.Wait()
+	c.Check(time.Since(start) < time.Second, Equals, true)
+}
+
+func (s *ProxySuite) TestAddedListeners(c *C) {
+	certificate := testcert.SelfSigned(c, "logs.example.com")
+	server, handler, _ := s.serve(c, []string{"127.0.0.1"}, func(server *Server) error {
+		server.SetTlsPeerNameFunc(nil)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		c.Assert(err, IsNil)
+		if err := server.AddListener(listener); err != nil {
+			return err
+		}
+
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		c.Assert(err, IsNil)
+		return server.AddTLSListener(listener, &tls.Config{Certificates: []tls.Certificate{certificate}})
+	})
+
+	conn, err := net.Dial("tcp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	conn.Write([]byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 514\r\n" + exampleSyslog + "\n"))
+	conn.Close()
+
+	conn, err = net.Dial("tcp", server.LocalAddrs()[1].String())
+	c.Assert(err, IsNil)
+	conn.Write([]byte("PROXY TCP4 192.0.2.2 127.0.0.1 56325 6514\r\n"))
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	_, err = tlsConn.Write([]byte(exampleSyslog + "\n"))
+	c.Assert(err, IsNil)
+	tlsConn.Close()
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	var clients []string
+	for _, logParts := range handler.logParts {
+		clients = append(clients, logParts["client"].(string))
+	}
+	sort.Strings(clients)
+	c.Check(clients, DeepEquals, []string{"192.0.2.1:56324", "192.0.2.2:56325"})
+}
+
+func (s *ProxySuite) TestAddedTLSListenerWithoutCertificates(c *C) {
+	server := NewServer()
+	c.Assert(server.SetProxyProtocol([]string{"127.0.0.1"}), IsNil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	c.Check(server.AddTLSListener(listener, &tls.Config{}), Equals, ErrNoCertificates)
+}
+
+func (s *ProxySuite) TestInvalidTrusted(c *C) {
+	c.Check(NewServer().SetProxyProtocol([]string{"10.0.0.0/33"}), NotNil)
+}
@@ -0,0 +1,320 @@
+package syslog
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// What the messages a rate limit is keyed by
+type RateLimitKey int
+
+const (
+	// The IP address of the client, or its unix socket address
+	RateLimitBySourceIP RateLimitKey = iota
+	// The hostname of the parsed message
+	RateLimitByHostname
+	// The app_name, or tag, of the parsed message
+	RateLimitByAppName
+)
+
+// What happens to the messages over a rate limit
+type RateLimitAction int
+
+const (
+	// The messages are not handed to the handler
+	RateLimitDrop RateLimitAction = iota
+	// One out of SampleRate messages is handed to the handler, with
+	// logParts["rate_limited"] set to true, the others are dropped
+	RateLimitSample
+	// The messages are handed to the handler with logParts["rate_limited"]
+	// set to true
+	RateLimitTag
+)
+
+// A token bucket for every key: Rate messages per second are allowed, with
+// bursts of up to Burst messages
+type RateLimit struct {
+	Rate       float64
+	Burst      int
+	Key        RateLimitKey
+	Action     RateLimitAction
+	SampleRate int
+}
+
+// The messages of a source over the limit since the previous summary, and how
+// many of them were not handed to the handler
+type RateLimitSummary struct {
+	Listener   string
+	Source     string
+	Limited    uint64
+	Suppressed uint64
+}
+
+// Receives the summaries of the sources which went over their limit
+type RateLimitSummaryFunc func(summaries []RateLimitSummary)
+
+// Buckets full and untouched for this long are forgotten
+const rateLimitPruneInterval = time.Minute
+
+//Sets the rate limit of every listener without a limit of its own
+func (s *Server) SetRateLimit(limit RateLimit) {
+	s.rateLimitMutex.Lock()
+	defer s.rateLimitMutex.Unlock()
+
+	s.rateLimiter = s.newRateLimiter(limit)
+}
+
+//Sets the rate limit of the listeners created for the given address, as given
+//to the Listen methods. Returns ErrUnknownListener when no listener was
+//created for addr
+func (s *Server) SetListenerRateLimit(addr string, limit RateLimit) error {
+	sources, err := s.sourcesOf(addr)
+	if err != nil {
+		return err
+	}
+
+	s.rateLimitMutex.Lock()
+	defer s.rateLimitMutex.Unlock()
+
+	for _, src := range sources {
+		src.rateLimiter = s.newRateLimiter(limit)
+	}
+
+	return nil
+}
+
+//Sets the function receiving, every interval, how many messages of every
+//source went over the rate limit. A last summary is given on shutdown
+func (s *Server) SetRateLimitSummaryFunc(interval time.Duration, summaryFunc RateLimitSummaryFunc) {
+	s.rateLimitMutex.Lock()
+	defer s.rateLimitMutex.Unlock()
+
+	s.rateLimitInterval = interval
+	s.rateLimitSummaryFunc = summaryFunc
+
+	limiters := []*rateLimiter{s.rateLimiter}
+	s.sourcesMutex.RLock()
+	for _, src := range s.sources {
+		limiters = append(limiters, src.rateLimiter)
+	}
+	s.sourcesMutex.RUnlock()
+	for _, limiter := range limiters {
+		if limiter != nil {
+			limiter.mutex.Lock()
+			limiter.keepCounts = s.summarizes()
+			limiter.mutex.Unlock()
+		}
+	}
+}
+
+type rateLimiter struct {
+	limit RateLimit
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	// Whether the buckets over the limit are kept until summarized
+	keepCounts bool
+}
+
+type tokenBucket struct {
+	tokens     float64
+	last       time.Time
+	limited    uint64
+	suppressed uint64
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	return &rateLimiter{
+		limit:     limit,
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+func (s *Server) newRateLimiter(limit RateLimit) *rateLimiter {
+	limiter := newRateLimiter(limit)
+	limiter.keepCounts = s.summarizes()
+
+	return limiter
+}
+
+// Whether the rate limit summaries are given, the counts are kept until then
+func (s *Server) summarizes() bool {
+	return s.rateLimitSummaryFunc != nil && s.rateLimitInterval > 0
+}
+
+// Returns the rate limiter of the source, if any
+func (s *Server) rateLimiterOf(src *source) *rateLimiter {
+	s.rateLimitMutex.RLock()
+	defer s.rateLimitMutex.RUnlock()
+
+	if src.rateLimiter != nil {
+		return src.rateLimiter
+	}
+
+	return s.rateLimiter
+}
+
+// Whether the message should be handed to the handler, and tagged
+func (l *rateLimiter) allow(client string, logParts format.LogParts) (deliver bool, limited bool) {
+	key := l.key(client, logParts)
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.limit.Rate
+	if max := float64(l.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, false
+	}
+
+	b.limited++
+	switch l.limit.Action {
+	case RateLimitTag:
+		return true, true
+	case RateLimitSample:
+		if l.limit.SampleRate > 0 && b.limited%uint64(l.limit.SampleRate) == 1%uint64(l.limit.SampleRate) {
+			return true, true
+		}
+	}
+
+	b.suppressed++
+	return false, true
+}
+
+func (l *rateLimiter) key(client string, logParts format.LogParts) string {
+	switch l.limit.Key {
+	case RateLimitByHostname:
+		hostname, _ := logParts["hostname"].(string)
+		return hostname
+	case RateLimitByAppName:
+		if appName, ok := logParts["app_name"].(string); ok {
+			return appName
+		}
+		tag, _ := logParts["tag"].(string)
+		return tag
+	default:
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			return host
+		}
+		return client
+	}
+}
+
+// Forgets the buckets which are full again, unless they have counts to be
+// summarized
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		full := b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= float64(l.limit.Burst)
+		if full && (b.limited == 0 || !l.keepCounts) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Returns the sources over the limit since the previous summary, listener is
+// empty for the limiter of every listener
+func (l *rateLimiter) summarize(listener string) []RateLimitSummary {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var summaries []RateLimitSummary
+	for key, b := range l.buckets {
+		if b.limited == 0 {
+			continue
+		}
+
+		summaries = append(summaries, RateLimitSummary{
+			Listener:   listener,
+			Source:     key,
+			Limited:    b.limited,
+			Suppressed: b.suppressed,
+		})
+		b.limited, b.suppressed = 0, 0
+	}
+
+	return summaries
+}
+
+func (s *Server) summarizeRateLimits() {
+	s.rateLimitMutex.RLock()
+	var summaries []RateLimitSummary
+	if s.rateLimiter != nil {
+		summaries = append(summaries, s.rateLimiter.summarize("")...)
+	}
+
+	s.sourcesMutex.RLock()
+	for _, src := range s.sources {
+		if src.rateLimiter != nil {
+			summaries = append(summaries, src.rateLimiter.summarize(src.name())...)
+		}
+	}
+	s.sourcesMutex.RUnlock()
+	s.rateLimitMutex.RUnlock()
+
+	if len(summaries) == 0 {
+		return
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Listener != summaries[j].Listener {
+			return summaries[i].Listener < summaries[j].Listener
+		}
+		return summaries[i].Source < summaries[j].Source
+	})
+
+	s.rateLimitSummaryFunc(summaries)
+}
+
+func (s *Server) goSummarizeRateLimits() {
+	if s.rateLimitSummaryFunc == nil || s.rateLimitInterval <= 0 {
+		return
+	}
+
+	s.wait.Add(1)
+	go func() {
+		defer s.wait.Done()
+
+		ticker := time.NewTicker(s.rateLimitInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.summarizeRateLimits()
+			case <-s.shutdown:
+				// The messages still in flight are not waited for
+				s.summarizeRateLimits()
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,163 @@
+package syslog
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type RateLimitSuite struct{}
+
+var _ = Suite(&RateLimitSuite{})
+
+// Parses the datagrams with the given rate limit, as received from clients
+func (s *RateLimitSuite) parse(limit RateLimit, messages []string, clients []string) (*Server, *handlerRecorder) {
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetRateLimit(limit)
+	server.goParseDatagrams()
+	for i, message := range messages {
+		server.datagramChannel <- DatagramMessage{message: []byte(message), client: clients[i]}
+	}
+	close(server.datagramChannel)
+	server.Wait()
+
+	return server, handler
+}
+
+func repeat(value string, count int) []string {
+	values := make([]string, count)
+	for i := range values {
+		values[i] = value
+	}
+
+	return values
+}
+
+func (s *RateLimitSuite) TestDropBySourceIP(c *C) {
+	clients := append(repeat("10.0.0.1:514", 5), repeat("10.0.0.2:514", 2)...)
+	server, handler := s.parse(RateLimit{Rate: 0.001, Burst: 2}, repeat(exampleSyslog, 7), clients)
+
+	c.Assert(handler.logParts, HasLen, 4)
+	for _, logParts := range handler.logParts {
+		c.Check(logParts["rate_limited"], IsNil)
+	}
+
+	c.Check(server.rateLimiter.summarize(""), DeepEquals, []RateLimitSummary{
+		{Source: "10.0.0.1", Limited: 3, Suppressed: 3},
+	})
+	c.Check(server.rateLimiter.summarize(""), HasLen, 0)
+}
+
+func (s *RateLimitSuite) TestSample(c *C) {
+	limit := RateLimit{Rate: 0.001, Burst: 1, Action: RateLimitSample, SampleRate: 2}
+	_, handler := s.parse(limit, repeat(exampleSyslog, 5), repeat("10.0.0.1:514", 5))
+
+	c.Assert(handler.logParts, HasLen, 3)
+	c.Check(handler.logParts[0]["rate_limited"], IsNil)
+	c.Check(handler.logParts[1]["rate_limited"], Equals, true)
+	c.Check(handler.logParts[2]["rate_limited"], Equals, true)
+}
+
+func (s *RateLimitSuite) TestTag(c *C) {
+	limit := RateLimit{Rate: 0.001, Burst: 2, Action: RateLimitTag}
+	server, handler := s.parse(limit, repeat(exampleSyslog, 5), repeat("10.0.0.1:514", 5))
+
+	c.Assert(handler.logParts, HasLen, 5)
+	c.Check(handler.logParts[1]["rate_limited"], IsNil)
+	c.Check(handler.logParts[2]["rate_limited"], Equals, true)
+	c.Check(server.rateLimiter.summarize(""), DeepEquals, []RateLimitSummary{
+		{Source: "10.0.0.1", Limited: 3},
+	})
+}
+
+func (s *RateLimitSuite) TestByAppName(c *C) {
+	messages := []string{
+		"<31>Dec 26 05:08:46 hostname sshd[296]: content",
+		"<31>Dec 26 05:08:46 hostname sshd[296]: content",
+		"<31>Dec 26 05:08:46 hostname cron[296]: content",
+	}
+	_, handler := s.parse(RateLimit{Rate: 0.001, Burst: 1, Key: RateLimitByAppName}, messages, repeat("10.0.0.1:514", 3))
+
+	c.Assert(handler.logParts, HasLen, 2)
+	c.Check(handler.logParts[0]["tag"], Equals, "sshd")
+	c.Check(handler.logParts[1]["tag"], Equals, "cron")
+}
+
+func (s *RateLimitSuite) TestRefill(c *C) {
+	limiter := newRateLimiter(RateLimit{Rate: 100, Burst: 1})
+
+	deliver, _ := limiter.allow("10.0.0.1:514", nil)
+	c.Check(deliver, Equals, true)
+	deliver, limited := limiter.allow("10.0.0.1:514", nil)
+	c.Check(deliver, Equals, false)
+	c.Check(limited, Equals, true)
+
+	time.Sleep(20 * time.Millisecond)
+	deliver, _ = limiter.allow("10.0.0.1:514", nil)
+	c.Check(deliver, Equals, true)
+}
+
+func (s *RateLimitSuite) TestPrune(c *C) {
+	for _, keepCounts := range []bool{false, true} {
+		limiter := newRateLimiter(RateLimit{Rate: 1000, Burst: 1})
+		limiter.keepCounts = keepCounts
+		limiter.allow("10.0.0.1:514", nil)
+		limiter.allow("10.0.0.1:514", nil)
+
+		// The bucket over the limit is full again, only kept for its summary
+		time.Sleep(5 * time.Millisecond)
+		limiter.lastPrune = time.Now().Add(-rateLimitPruneInterval)
+		limiter.allow("10.0.0.2:514", nil)
+
+		_, kept := limiter.buckets["10.0.0.1"]
+		c.Check(kept, Equals, keepCounts)
+
+		limiter.summarize("")
+		limiter.lastPrune = time.Now().Add(-rateLimitPruneInterval)
+		limiter.allow("10.0.0.2:514", nil)
+		c.Check(limiter.buckets, HasLen, 1)
+	}
+}
+
+func (s *RateLimitSuite) TestListenerSummary(c *C) {
+	var mutex sync.Mutex
+	var summaries []RateLimitSummary
+
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetRateLimit(RateLimit{Rate: 1000, Burst: 1000})
+	c.Assert(server.ListenUDP("127.0.0.1:0"), IsNil)
+	c.Assert(server.SetListenerRateLimit("127.0.0.1:0", RateLimit{Rate: 0.001, Burst: 1}), IsNil)
+	c.Check(server.SetListenerRateLimit("127.0.0.1:514", RateLimit{}), Equals, ErrUnknownListener)
+	c.Assert(server.SetListenerName("127.0.0.1:0", "udp"), IsNil)
+	server.SetRateLimitSummaryFunc(time.Hour, func(s []RateLimitSummary) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		summaries = append(summaries, s...)
+	})
+	c.Assert(server.Boot(), IsNil)
+
+	conn, err := net.Dial("udp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		conn.Write([]byte(exampleSyslog))
+	}
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Check(handler.logParts, HasLen, 1)
+	mutex.Lock()
+	defer mutex.Unlock()
+	c.Check(summaries, DeepEquals, []RateLimitSummary{
+		{Listener: "udp", Source: "127.0.0.1", Limited: 2, Suppressed: 2},
+	})
+}
@@ -0,0 +1,206 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Reported, with OpFrame, for the RELP frames which cannot be read or come
+// out of sequence, the connection is then closed
+var ErrRELPFrame = errors.New("invalid RELP frame")
+
+const (
+	// The longest RELP header: a transaction number of 9 digits, a command of
+	// 32 letters and the data length, separated by spaces
+	maxRELPHeaderSize = 9 + 1 + 32 + 1 + 9 + 1
+	maxRELPTxnr       = 999999999
+	relpOffers        = "relp_version=0\nrelp_software=go-syslog\ncommands=syslog"
+)
+
+// Closes the session once the client has been answered
+var errRELPClosed = errors.New("RELP session closed")
+
+//Configure the server for listen on a TCP addr for RELP, the Reliable Event
+//Logging Protocol of rsyslog, over TLS unless config is nil. Every message is
+//acknowledged once the handler returns, so the client sends again those not
+//acknowledged when a connection is lost
+func (s *Server) ListenRELP(addr string, config *tls.Config) error {
+	var listener net.Listener
+	var proxy *proxyProtocol
+	var err error
+	transport := "tcp"
+	if config != nil {
+		listener, proxy, err = s.listenTLS(addr, config)
+		transport = "tls"
+	} else {
+		listener, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.addListener(listener, addr, transport); err != nil {
+		listener.Close()
+		return err
+	}
+	s.sources[listener].relp = true
+	if proxy != nil {
+		s.sources[listener].proxy = proxy
+	}
+
+	return nil
+}
+
+// State of a RELP connection
+type relpSession struct {
+	writer io.Writer
+	opened bool
+	// Transaction number of the last command
+	txnr int
+}
+
+// Splits RELP frames: the transaction number, the command, the data length
+// and the data, if any, separated by spaces and ended by a new line
+func relpSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	fields := 0
+	start := 0
+	for i, c := range data {
+		if i >= maxRELPHeaderSize {
+			return 0, nil, ErrRELPFrame
+		}
+
+		if c != ' ' && c != '\n' {
+			continue
+		}
+
+		if i == start {
+			return 0, nil, ErrRELPFrame
+		}
+
+		fields++
+		if fields < 3 {
+			if c != ' ' {
+				return 0, nil, ErrRELPFrame
+			}
+			start = i + 1
+			continue
+		}
+
+		length, err := strconv.Atoi(string(data[start:i]))
+		if err != nil || length < 0 {
+			return 0, nil, ErrRELPFrame
+		}
+
+		end := i + 1
+		if length > 0 {
+			if c != ' ' {
+				return 0, nil, ErrRELPFrame
+			}
+			end += length + 1
+		} else if c != '\n' {
+			// Some clients separate an empty data by a space too
+			end++
+		}
+
+		if len(data) < end {
+			return 0, nil, nil
+		}
+
+		if data[end-1] != '\n' {
+			return 0, nil, ErrRELPFrame
+		}
+
+		return end, data[:end], nil
+	}
+
+	return 0, nil, nil
+}
+
+// Parses a frame given by relpSplit
+func parseRELPFrame(frame []byte) (txnr int, command string, data []byte, err error) {
+	fields := bytes.SplitN(frame[:len(frame)-1], []byte(" "), 4)
+	if len(fields) < 3 {
+		return 0, "", nil, ErrRELPFrame
+	}
+
+	txnr, err = strconv.Atoi(string(fields[0]))
+	if err != nil || txnr < 1 || txnr > maxRELPTxnr {
+		return 0, "", nil, ErrRELPFrame
+	}
+
+	for _, c := range fields[1] {
+		if c < 'a' || c > 'z' {
+			return 0, "", nil, ErrRELPFrame
+		}
+	}
+
+	if len(fields) == 4 {
+		data = fields[3]
+	}
+
+	return txnr, string(fields[1]), data, nil
+}
+
+// Handles a RELP command, the syslog messages are acknowledged once handled
+// and refused when the rate limiter drops them.
+// Returns errRELPClosed once the session is over
+func (s *Server) relpCommand(session *relpSession, frame []byte, o origin) error {
+	txnr, command, data, err := parseRELPFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	// Only sent in answer to the commands of the server, which are not used
+	if command == "rsp" {
+		return nil
+	}
+
+	// The transaction numbers follow each other, wrapping after the maximum
+	if session.opened && txnr != session.txnr%maxRELPTxnr+1 {
+		return ErrRELPFrame
+	}
+	session.txnr = txnr
+
+	switch command {
+	case "open":
+		if session.opened {
+			return ErrRELPFrame
+		}
+		session.opened = true
+		return session.respond(txnr, "200 OK\n"+relpOffers)
+	}
+
+	if !session.opened {
+		session.respond(txnr, "500 session not opened")
+		return ErrRELPFrame
+	}
+
+	switch command {
+	case "syslog":
+		if !s.parser(data, o, s.receiveTime(), false) {
+			return session.respond(txnr, "500 message dropped")
+		}
+		return session.respond(txnr, "200 OK")
+	case "close":
+		session.respond(txnr, "")
+		return errRELPClosed
+	default:
+		return session.respond(txnr, "500 command not supported")
+	}
+}
+
+func (session *relpSession) respond(txnr int, data string) error {
+	var err error
+	if data == "" {
+		_, err = fmt.Fprintf(session.writer, "%d rsp 0\n", txnr)
+	} else {
+		_, err = fmt.Fprintf(session.writer, "%d rsp %d %s\n", txnr, len(data), data)
+	}
+
+	return err
+}
@@ -0,0 +1,206 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/internal/testcert"
+)
+
+type RELPSuite struct{}
+
+var _ = Suite(&RELPSuite{})
+
+// A RELP client sending commands one at a time
+type relpClient struct {
+	c      *C
+	conn   net.Conn
+	reader *bufio.Reader
+	txnr   int
+}
+
+func (client *relpClient) command(command, data string) string {
+	client.txnr++
+	frame := fmt.Sprintf("%d %s %d", client.txnr, command, len(data))
+	if data != "" {
+		frame += " " + data
+	}
+	_, err := client.conn.Write([]byte(frame + "\n"))
+	client.c.Assert(err, IsNil)
+
+	return client.response()
+}
+
+// Reads a response, returns its data
+func (client *relpClient) response() string {
+	client.conn.SetReadDeadline(time.Now().Add(time.Second))
+	header, err := client.reader.ReadString(' ')
+	client.c.Assert(err, IsNil)
+	client.c.Check(header, Equals, fmt.Sprintf("%d ", client.txnr))
+
+	var command string
+	var length int
+	_, err = fmt.Fscanf(client.reader, "%s %d", &command, &length)
+	client.c.Assert(err, IsNil)
+	client.c.Check(command, Equals, "rsp")
+
+	// The data, if any, follows a space and the response ends by a new line
+	data := make([]byte, length+1)
+	if length > 0 {
+		data = make([]byte, length+2)
+	}
+	_, err = io.ReadFull(client.reader, data)
+	client.c.Assert(err, IsNil)
+
+	return strings.TrimSpace(string(data))
+}
+
+func (s *RELPSuite) serve(c *C, handler Handler, config *tls.Config) *Server {
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	server.SetTlsPeerNameFunc(nil)
+	c.Assert(server.ListenRELP("127.0.0.1:0", config), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	return server
+}
+
+func (s *RELPSuite) TestSession(c *C) {
+	handler := &handlerBlocking{release: make(chan struct{})}
+	server := s.serve(c, handler, nil)
+	defer server.Kill()
+
+	conn, err := net.Dial("tcp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	client := &relpClient{c: c, conn: conn, reader: bufio.NewReader(conn)}
+
+	c.Check(client.command("open", "relp_version=0\nrelp_software=test\ncommands=syslog"), Equals, "200 OK\n"+relpOffers)
+
+	acked := make(chan string)
+	go func() {
+		acked <- client.command("syslog", exampleRFC5424Syslog)
+	}()
+
+	select {
+	case <-acked:
+		c.Fatal("acknowledged before being handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(handler.release)
+	c.Check(<-acked, Equals, "200 OK")
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.logParts[0]["app_name"], Equals, "su")
+
+	c.Check(client.command("starttls", ""), Equals, "500 command not supported")
+	c.Check(client.command("close", ""), Equals, "")
+	c.Check(closedByPeer(conn), Equals, true)
+}
+
+func (s *RELPSuite) TestRateLimited(c *C) {
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	server.SetRateLimit(RateLimit{Rate: 0.001, Burst: 1})
+	c.Assert(server.ListenRELP("127.0.0.1:0", nil), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	conn, err := net.Dial("tcp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	client := &relpClient{c: c, conn: conn, reader: bufio.NewReader(conn)}
+
+	c.Check(client.command("open", "relp_version=0"), Matches, "(?s)200 OK\n.*")
+	c.Check(client.command("syslog", exampleRFC5424Syslog), Equals, "200 OK")
+	c.Check(client.command("syslog", exampleRFC5424Syslog), Equals, "500 message dropped")
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	c.Check(handler.logParts, HasLen, 1)
+}
+
+func (s *RELPSuite) TestTLS(c *C) {
+	certificate := testcert.SelfSigned(c, "logs.example.com")
+	handler := new(handlerRecorder)
+	server := s.serve(c, handler, &tls.Config{Certificates: []tls.Certificate{certificate}})
+	defer server.Kill()
+
+	conn, err := tls.Dial("tcp", server.LocalAddrs()[0].String(), &tls.Config{InsecureSkipVerify: true})
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	client := &relpClient{c: c, conn: conn, reader: bufio.NewReader(conn)}
+
+	c.Check(client.command("open", "relp_version=0"), Matches, "(?s)200 OK\n.*")
+	for i := 0; i < 3; i++ {
+		c.Check(client.command("syslog", exampleRFC5424Syslog), Equals, "200 OK")
+	}
+	c.Check(server.Stats().Listeners[0].Transport, Equals, "tls")
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	c.Check(handler.logParts, HasLen, 3)
+}
+
+func (s *RELPSuite) TestProtocolErrors(c *C) {
+	recorder := new(errorRecorder)
+	server := s.serve(c, new(handlerRecorder), nil)
+	server.SetTransportErrorHandler(recorder.transportError)
+	defer server.Kill()
+
+	for _, frames := range []string{
+		"1 syslog 3 abc\n",
+		"1 open 0\n3 syslog 3 abc\n",
+		"1 open 0\n2 syslog 1 abc\n",
+		"x open 0\n",
+	} {
+		conn, err := net.Dial("tcp", server.LocalAddrs()[0].String())
+		c.Assert(err, IsNil)
+		conn.Write([]byte(frames))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = ioutil.ReadAll(conn)
+		c.Check(err, IsNil, Commentf("%q", frames))
+		conn.Close()
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	c.Assert(recorder.transportErrors, HasLen, 4)
+	for _, err := range recorder.transportErrors {
+		c.Check(err.Op, Equals, OpFrame)
+		c.Check(err.Err, Equals, ErrRELPFrame)
+	}
+}
+
+func (s *RELPSuite) TestSplit(c *C) {
+	for _, t := range []struct {
+		data    string
+		advance int
+		err     error
+	}{
+		{"1 open 0\n", 9, nil},
+		{"1 close 0 \n", 11, nil},
+		{"12 syslog 5 hello\n2 rsp", 18, nil},
+		{"12 syslog 5 hello", 0, nil},
+		{"12 syslog", 0, nil},
+		{"12 syslog 5 hello!\n", 0, ErrRELPFrame},
+		{"12  syslog 5 hello\n", 0, ErrRELPFrame},
+		{"12 syslog\n", 0, ErrRELPFrame},
+		{"12 syslog x hello\n", 0, ErrRELPFrame},
+		{strings.Repeat("1", maxRELPHeaderSize+1), 0, ErrRELPFrame},
+	} {
+		advance, _, err := relpSplit([]byte(t.data), false)
+		c.Check(advance, Equals, t.advance, Commentf("%q", t.data))
+		c.Check(err, Equals, t.err, Commentf("%q", t.data))
+	}
+}
@@ -0,0 +1,281 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidFingerprint = errors.New("invalid certificate fingerprint")
+	// Reported, with OpFrame, when a frame on an RFC5425 listener is not
+	// octet counted
+	ErrNotOctetCounted = errors.New("frame is not octet counted")
+	// Returned by the TLS listeners given a config without certificates
+	ErrNoCertificates = errors.New("tls: neither Certificates, GetCertificate, nor GetConfigForClient set in Config")
+)
+
+// The peers an RFC5425 listener accepts, see section 5.2 of the RFC. A peer
+// is accepted when the fingerprint of its certificate matches, or one of the
+// DNS names of its subjectAltName when the certificate is signed by one of the
+// ClientCAs of the config running the handshake, the one returned by
+// GetConfigForClient if any, or by the system roots if nil.
+type PeerAuthorization struct {
+	// Certificate fingerprints, the hash algorithm followed by the hex
+	// digest, like "SHA-256:E1:2D:..." or "SHA1:E12D...". SHA-1 and SHA-256
+	// are supported. The first one matching, in this order, names the peer.
+	Fingerprints []string
+	// DNS names or wildcard patterns, like "*.example.com", where the
+	// wildcard matches a single label
+	DNSNames []string
+}
+
+//Configure the server for listen on a TCP addr for TLS following RFC5425,
+//frames must be octet counted and the peers are authorized against peers.
+//Without fingerprints nor DNS names the TlsPeerNameFunc is used instead.
+func (s *Server) ListenRFC5425(addr string, config *tls.Config, peers PeerAuthorization) error {
+	if config == nil {
+		return ErrNoCertificates
+	}
+
+	authorizer, err := newPeerAuthorizer(peers)
+	if err != nil {
+		return err
+	}
+
+	if authorizer != nil {
+		config = authorizer.handshakeConfig(config)
+		if getConfigForClient := config.GetConfigForClient; getConfigForClient != nil {
+			config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				handshake, err := getConfigForClient(hello)
+				if handshake != nil {
+					handshake = authorizer.handshakeConfig(handshake)
+				}
+				return handshake, err
+			}
+		}
+	}
+
+	listener, proxy, err := s.listenTLS(addr, config)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addListener(listener, addr, "tls"); err != nil {
+		listener.Close()
+		return err
+	}
+	s.sources[listener].rfc5425 = true
+	s.sources[listener].peers = authorizer
+	s.sources[listener].proxy = proxy
+
+	return nil
+}
+
+type peerAuthorizer struct {
+	// In configuration order, the first matching one names the peer
+	fingerprints []pinnedFingerprint
+	dnsNames     []string
+}
+
+type pinnedFingerprint struct {
+	algorithm string
+	digest    []byte
+	// As reported in tls_peer
+	canonical string
+}
+
+func newPeerAuthorizer(peers PeerAuthorization) (*peerAuthorizer, error) {
+	if len(peers.Fingerprints) == 0 && len(peers.DNSNames) == 0 {
+		return nil, nil
+	}
+
+	a := &peerAuthorizer{}
+	for _, fingerprint := range peers.Fingerprints {
+		algorithm, digest, err := parseFingerprint(fingerprint)
+		if err != nil {
+			return nil, err
+		}
+
+		a.fingerprints = append(a.fingerprints, pinnedFingerprint{
+			algorithm: algorithm,
+			digest:    digest,
+			canonical: formatFingerprint(algorithm, digest),
+		})
+	}
+
+	for _, name := range peers.DNSNames {
+		a.dnsNames = append(a.dnsNames, strings.ToLower(strings.TrimSuffix(name, ".")))
+	}
+
+	return a, nil
+}
+
+// Returns a copy of the config of a handshake which authorizes the peer.
+// Pinned certificates may well be self-signed, so they are only required by
+// the handshake and checked once it is done, the chain included for the DNS
+// names, against the ClientCAs of the config which ran the handshake
+func (a *peerAuthorizer) handshakeConfig(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	if config.ClientAuth < tls.RequireAnyClientCert {
+		config.ClientAuth = tls.RequireAnyClientCert
+	}
+
+	verifyConnection := config.VerifyConnection
+	roots := config.ClientCAs
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if verifyConnection != nil {
+			if err := verifyConnection(state); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := a.authorize(state, roots); !ok {
+			return errTlsPeerRejected
+		}
+
+		return nil
+	}
+
+	return config
+}
+
+// Returns the identity of the peer which matched, the canonical fingerprint
+// or the DNS name of the certificate. For the DNS names the chain is verified
+// against roots, the system roots if nil, unless it was by the handshake
+func (a *peerAuthorizer) authorize(state tls.ConnectionState, roots *x509.CertPool) (tlsPeer string, ok bool) {
+	return a.match(state, func() bool {
+		return verified(state, roots)
+	})
+}
+
+// Returns the identity of a peer authorized by the handshake
+func (a *peerAuthorizer) peer(state tls.ConnectionState) (tlsPeer string, ok bool) {
+	return a.match(state, func() bool {
+		return true
+	})
+}
+
+func (a *peerAuthorizer) match(state tls.ConnectionState, verified func() bool) (tlsPeer string, ok bool) {
+	if len(state.PeerCertificates) == 0 {
+		return "", false
+	}
+	cert := state.PeerCertificates[0]
+
+	// The digests of the certificate, computed once by algorithm
+	digests := make(map[string][]byte, 2)
+	for _, fingerprint := range a.fingerprints {
+		digest, ok := digests[fingerprint.algorithm]
+		if !ok {
+			digest = certificateDigest(fingerprint.algorithm, cert)
+			digests[fingerprint.algorithm] = digest
+		}
+
+		if bytes.Equal(digest, fingerprint.digest) {
+			return fingerprint.canonical, true
+		}
+	}
+
+	if len(a.dnsNames) == 0 || !verified() {
+		return "", false
+	}
+
+	for _, name := range cert.DNSNames {
+		for _, pattern := range a.dnsNames {
+			if matchDNSName(pattern, name) {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Tells whether the certificate of the peer chains to the roots, as it is not
+// verified by the handshake unless the config requires it
+func verified(state tls.ConnectionState, roots *x509.CertPool) bool {
+	if len(state.VerifiedChains) > 0 {
+		return true
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
+
+const (
+	fingerprintSHA1   = "SHA-1"
+	fingerprintSHA256 = "SHA-256"
+)
+
+func parseFingerprint(fingerprint string) (algorithm string, digest []byte, err error) {
+	i := strings.Index(fingerprint, ":")
+	if i < 0 {
+		return "", nil, ErrInvalidFingerprint
+	}
+
+	size := 0
+	switch strings.ToUpper(strings.Replace(fingerprint[:i], "-", "", -1)) {
+	case "SHA1":
+		algorithm, size = fingerprintSHA1, sha1.Size
+	case "SHA256":
+		algorithm, size = fingerprintSHA256, sha256.Size
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported hash algorithm %q", ErrInvalidFingerprint, fingerprint[:i])
+	}
+
+	digest, err = hex.DecodeString(strings.Replace(fingerprint[i+1:], ":", "", -1))
+	if err != nil || len(digest) != size {
+		return "", nil, fmt.Errorf("%w: %q", ErrInvalidFingerprint, fingerprint)
+	}
+
+	return algorithm, digest, nil
+}
+
+// Formats a fingerprint as in RFC5425, like "SHA-256:E1:2D:..."
+func formatFingerprint(algorithm string, digest []byte) string {
+	var buf bytes.Buffer
+	buf.WriteString(algorithm)
+	for _, b := range digest {
+		fmt.Fprintf(&buf, ":%02X", b)
+	}
+
+	return buf.String()
+}
+
+func certificateDigest(algorithm string, cert *x509.Certificate) []byte {
+	switch algorithm {
+	case fingerprintSHA1:
+		digest := sha1.Sum(cert.Raw)
+		return digest[:]
+	default:
+		digest := sha256.Sum256(cert.Raw)
+		return digest[:]
+	}
+}
+
+// Matches a DNS name against a pattern, where a leading "*" matches exactly
+// one label as in RFC6125
+func matchDNSName(pattern, name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if !strings.HasPrefix(pattern, "*.") {
+		return pattern == name
+	}
+
+	i := strings.Index(name, ".")
+	return i > 0 && name[i:] == pattern[1:]
+}
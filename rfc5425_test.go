@@ -0,0 +1,167 @@
+package syslog
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/internal/testcert"
+)
+
+type RFC5425Suite struct{}
+
+var _ = Suite(&RFC5425Suite{})
+
+func (s *RFC5425Suite) send(c *C, peers PeerAuthorization, client tls.Certificate, data string) (*handlerRecorder, *errorRecorder) {
+	return s.sendVerified(c, nil, peers, client, data)
+}
+
+// Sends data with the client certificate to a server trusting clientCAs
+func (s *RFC5425Suite) sendVerified(c *C, clientCAs *x509.CertPool, peers PeerAuthorization, client tls.Certificate, data string) (*handlerRecorder, *errorRecorder) {
+	handler := new(handlerRecorder)
+	recorder := new(errorRecorder)
+	server := NewServer()
+	server.SetFormat(RFC5424)
+	server.SetHandler(handler)
+	server.SetTransportErrorHandler(recorder.transportError)
+	config := &tls.Config{Certificates: []tls.Certificate{testcert.SelfSigned(c, "server.example.com")}, ClientCAs: clientCAs}
+	c.Assert(server.ListenRFC5425("127.0.0.1:0", config, peers), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	conn, err := tls.Dial("tcp", server.LocalAddrs()[0].String(), &tls.Config{
+		Certificates:       []tls.Certificate{client},
+		InsecureSkipVerify: true,
+	})
+	c.Assert(err, IsNil)
+	io.WriteString(conn, data)
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Check(server.Shutdown(ctx), IsNil)
+	return handler, recorder
+}
+
+func fingerprint(digest []byte) string {
+	return formatFingerprint(fingerprintSHA256, digest)
+}
+
+func (s *RFC5425Suite) TestFingerprintSHA256(c *C) {
+	client := testcert.SelfSigned(c, "client.example.com")
+	digest := sha256.Sum256(client.Certificate[0])
+	peers := PeerAuthorization{Fingerprints: []string{fmt.Sprintf("sha-256:%x", digest)}}
+	handler, recorder := s.send(c, peers, client, octetFrame(exampleRFC5424Syslog))
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.logParts[0]["tls_peer"], Equals, fingerprint(digest[:]))
+	c.Check(handler.logParts[0]["hostname"], Equals, "mymachine.example.com")
+	c.Check(recorder.transportErrors, HasLen, 0)
+}
+
+func (s *RFC5425Suite) TestFingerprintSHA1(c *C) {
+	client := testcert.SelfSigned(c, "client.example.com")
+	digest := sha1.Sum(client.Certificate[0])
+	peers := PeerAuthorization{Fingerprints: []string{formatFingerprint(fingerprintSHA1, digest[:])}}
+	handler, _ := s.send(c, peers, client, octetFrame(exampleRFC5424Syslog))
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.logParts[0]["tls_peer"], Equals, formatFingerprint(fingerprintSHA1, digest[:]))
+}
+
+func (s *RFC5425Suite) TestFingerprintOrder(c *C) {
+	client := testcert.SelfSigned(c, "client.example.com")
+	sha256Digest := sha256.Sum256(client.Certificate[0])
+	sha1Digest := sha1.Sum(client.Certificate[0])
+	sha256Fingerprint := fingerprint(sha256Digest[:])
+	sha1Fingerprint := formatFingerprint(fingerprintSHA1, sha1Digest[:])
+
+	// The first fingerprint configured names the peer
+	for _, fingerprints := range [][]string{
+		{sha1Fingerprint, sha256Fingerprint},
+		{sha256Fingerprint, sha1Fingerprint},
+	} {
+		handler, _ := s.send(c, PeerAuthorization{Fingerprints: fingerprints}, client, octetFrame(exampleRFC5424Syslog))
+
+		c.Assert(handler.logParts, HasLen, 1)
+		c.Check(handler.logParts[0]["tls_peer"], Equals, fingerprints[0])
+	}
+}
+
+func (s *RFC5425Suite) TestDNSName(c *C) {
+	ca, caCert := testcert.Authority(c)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	client := testcert.Signed(c, ca, caCert, "client.example.com")
+	peers := PeerAuthorization{DNSNames: []string{"*.Example.com"}}
+	handler, _ := s.sendVerified(c, roots, peers, client, octetFrame(exampleRFC5424Syslog))
+
+	c.Assert(handler.logParts, HasLen, 1)
+	c.Check(handler.logParts[0]["tls_peer"], Equals, "client.example.com")
+}
+
+func (s *RFC5425Suite) TestDNSNameNotVerified(c *C) {
+	client := testcert.SelfSigned(c, "client.example.com")
+	peers := PeerAuthorization{DNSNames: []string{"*.example.com"}}
+	handler, recorder := s.send(c, peers, client, octetFrame(exampleRFC5424Syslog))
+
+	c.Check(handler.logParts, HasLen, 0)
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpPeer)
+}
+
+func (s *RFC5425Suite) TestNilConfig(c *C) {
+	server := NewServer()
+	c.Assert(server.ListenRFC5425("127.0.0.1:0", nil, PeerAuthorization{}), Equals, ErrNoCertificates)
+}
+
+func (s *RFC5425Suite) TestPeerRejected(c *C) {
+	client := testcert.SelfSigned(c, "client.example.org")
+	digest := sha256.Sum256([]byte("another certificate"))
+	peers := PeerAuthorization{
+		Fingerprints: []string{fingerprint(digest[:])},
+		DNSNames:     []string{"*.example.com"},
+	}
+	handler, recorder := s.send(c, peers, client, octetFrame(exampleRFC5424Syslog))
+
+	c.Check(handler.logParts, HasLen, 0)
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpPeer)
+}
+
+func (s *RFC5425Suite) TestNotOctetCounted(c *C) {
+	client := testcert.SelfSigned(c, "client.example.com")
+	digest := sha256.Sum256(client.Certificate[0])
+	peers := PeerAuthorization{Fingerprints: []string{fingerprint(digest[:])}}
+	handler, recorder := s.send(c, peers, client, octetFrame(exampleRFC5424Syslog)+exampleRFC5424Syslog+"\n")
+
+	c.Check(handler.logParts, HasLen, 1)
+	c.Assert(recorder.transportErrors, HasLen, 1)
+	c.Check(recorder.transportErrors[0].Op, Equals, OpFrame)
+	c.Check(recorder.transportErrors[0].Err, Equals, ErrNotOctetCounted)
+}
+
+func (s *RFC5425Suite) TestInvalidFingerprint(c *C) {
+	server := NewServer()
+	for _, fingerprint := range []string{"E1:2D", "MD5:E1:2D", "SHA1:E1:2D", "SHA-256:zz"} {
+		err := server.ListenRFC5425("127.0.0.1:0", &tls.Config{}, PeerAuthorization{Fingerprints: []string{fingerprint}})
+		c.Check(errors.Is(err, ErrInvalidFingerprint), Equals, true, Commentf(fingerprint))
+	}
+	c.Check(server.LocalAddrs(), HasLen, 0)
+}
+
+func (s *RFC5425Suite) TestMatchDNSName(c *C) {
+	c.Check(matchDNSName("*.example.com", "a.example.com"), Equals, true)
+	c.Check(matchDNSName("*.example.com", "A.Example.COM."), Equals, true)
+	c.Check(matchDNSName("*.example.com", "a.b.example.com"), Equals, false)
+	c.Check(matchDNSName("*.example.com", "example.com"), Equals, false)
+	c.Check(matchDNSName("a.example.com", "a.example.com"), Equals, true)
+	c.Check(matchDNSName("a.example.com", "b.example.com"), Equals, false)
+}
@@ -0,0 +1,162 @@
+package sender
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+const (
+	NILVALUE = "-"
+
+	rfc5424TimestampFormat = "2006-01-02T15:04:05.999999Z07:00"
+)
+
+var (
+	ErrUnknownFormat = errors.New("format not supported by the sender")
+
+	sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+)
+
+// Encode builds the syslog line of the message in the given format, without
+// any framing. RFC6587 is encoded as RFC5424, Automatic is not supported
+func Encode(f format.Format, m *format.Message) ([]byte, error) {
+	switch f.(type) {
+	case *format.RFC3164:
+		return encodeRFC3164(m), nil
+	case *format.RFC5424, *format.RFC6587:
+		return encodeRFC5424(m), nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+func encodeRFC3164(m *format.Message) []byte {
+	var b bytes.Buffer
+
+	writePriority(&b, m)
+	b.WriteString(timestamp(m).Format(time.Stamp))
+	b.WriteByte(' ')
+	b.WriteString(hostname(m))
+	b.WriteByte(' ')
+
+	if m.AppName != "" {
+		b.WriteString(m.AppName)
+		if m.ProcID != "" {
+			b.WriteByte('[')
+			b.WriteString(m.ProcID)
+			b.WriteByte(']')
+		}
+		b.WriteString(": ")
+	}
+
+	b.WriteString(m.Message)
+
+	return b.Bytes()
+}
+
+// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func encodeRFC5424(m *format.Message) []byte {
+	var b bytes.Buffer
+
+	version := m.Version
+	if version <= 0 {
+		version = 1
+	}
+
+	writePriority(&b, m)
+	b.WriteString(strconv.Itoa(version))
+	b.WriteByte(' ')
+	b.WriteString(timestamp(m).Format(rfc5424TimestampFormat))
+	b.WriteByte(' ')
+	b.WriteString(nilValue(hostname(m), 255))
+	b.WriteByte(' ')
+	b.WriteString(nilValue(m.AppName, 48))
+	b.WriteByte(' ')
+	b.WriteString(nilValue(m.ProcID, 128))
+	b.WriteByte(' ')
+	b.WriteString(nilValue(m.MsgID, 32))
+	b.WriteByte(' ')
+
+	switch {
+	case len(m.StructuredData) > 0:
+		writeStructuredData(&b, m.StructuredData)
+	case m.RawStructuredData != "":
+		b.WriteString(m.RawStructuredData)
+	default:
+		b.WriteString(NILVALUE)
+	}
+
+	if m.Message != "" {
+		b.WriteByte(' ')
+		b.WriteString(m.Message)
+	}
+
+	return b.Bytes()
+}
+
+func writeStructuredData(b *bytes.Buffer, elements []format.SDElement) {
+	for _, element := range elements {
+		b.WriteByte('[')
+		b.WriteString(element.ID)
+		for _, param := range element.Params {
+			b.WriteByte(' ')
+			b.WriteString(param.Name)
+			b.WriteString(`="`)
+			sdEscaper.WriteString(b, param.Value)
+			b.WriteByte('"')
+		}
+		b.WriteByte(']')
+	}
+}
+
+// The priority is computed from the facility and severity, unless both are
+// zero in which case the Priority field is used as is
+func writePriority(b *bytes.Buffer, m *format.Message) {
+	pri := m.Facility*8 + m.Severity
+	if pri == 0 {
+		pri = m.Priority
+	}
+
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(pri))
+	b.WriteByte('>')
+}
+
+func timestamp(m *format.Message) time.Time {
+	if m.Timestamp.IsZero() {
+		return time.Now()
+	}
+
+	return m.Timestamp
+}
+
+func hostname(m *format.Message) string {
+	if m.Hostname != "" {
+		return m.Hostname
+	}
+
+	h, _ := os.Hostname()
+	return h
+}
+
+// Replaces empty values by the NILVALUE, spaces are not allowed in the header
+// fields so they are replaced as well and the value truncated to its maximum
+func nilValue(value string, maxLen int) string {
+	if value == "" {
+		return NILVALUE
+	}
+
+	value = strings.Replace(value, " ", "_", -1)
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+
+	return value
+}
@@ -0,0 +1,66 @@
+package sender
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+type EncodeSuite struct{}
+
+var _ = Suite(&EncodeSuite{})
+
+var exampleTimestamp = time.Date(2003, time.October, 11, 22, 14, 15, 3*10e5, time.UTC)
+
+func (s *EncodeSuite) TestEncodeRFC3164(c *C) {
+	m := &format.Message{
+		Facility:  1,
+		Severity:  5,
+		Timestamp: exampleTimestamp,
+		Hostname:  "myhostname",
+		AppName:   "myprogram",
+		ProcID:    "42",
+		Message:   "ciao",
+	}
+
+	line, err := Encode(&format.RFC3164{}, m)
+	c.Assert(err, IsNil)
+	c.Assert(string(line), Equals, "<13>Oct 11 22:14:15 myhostname myprogram[42]: ciao")
+}
+
+func (s *EncodeSuite) TestEncodeRFC5424(c *C) {
+	m := &format.Message{
+		Facility:  20,
+		Severity:  5,
+		Timestamp: exampleTimestamp,
+		Hostname:  "mymachine.example.com",
+		AppName:   "evntslog",
+		MsgID:     "ID47",
+		StructuredData: []format.SDElement{
+			{ID: "exampleSDID@32473", Params: []format.SDParam{{Name: "iut", Value: "3"}, {Name: "path", Value: `C:\tmp "a]"`}}},
+		},
+		Message: "An application event log entry...",
+	}
+
+	line, err := Encode(&format.RFC5424{}, m)
+	c.Assert(err, IsNil)
+	c.Assert(string(line), Equals, `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" path="C:\\tmp \"a\]\""] An application event log entry...`)
+}
+
+func (s *EncodeSuite) TestEncodeRFC5424NilValues(c *C) {
+	m := &format.Message{
+		Priority:  34,
+		Timestamp: exampleTimestamp,
+		Hostname:  "mymachine",
+	}
+
+	line, err := Encode(&format.RFC6587{}, m)
+	c.Assert(err, IsNil)
+	c.Assert(string(line), Equals, "<34>1 2003-10-11T22:14:15.003Z mymachine - - - -")
+}
+
+func (s *EncodeSuite) TestEncodeUnknownFormat(c *C) {
+	_, err := Encode(&format.Automatic{}, &format.Message{})
+	c.Assert(err, Equals, ErrUnknownFormat)
+}
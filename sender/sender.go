@@ -0,0 +1,226 @@
+/*
+Syslog client, sends RFC3164 and RFC5424 messages over UDP, TCP, TLS or Unix
+datagram sockets
+*/
+package sender // import "gopkg.in/mcuadros/go-syslog.v2/sender"
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+// Framing used on stream transports (TCP and TLS), see RFC6587
+type Framing int
+
+const (
+	// Frame chosen from the format: octet counting for RFC6587, LF otherwise
+	DefaultFraming Framing = iota
+	// RFC6587 s3.4.2 non-transparent framing, every message ends with a LF
+	NonTransparentFraming
+	// RFC6587 s3.4.1 octet counting, every message is prefixed by its length
+	OctetCountingFraming
+)
+
+const (
+	defaultRetries    = 3
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+)
+
+var ErrUnknownNetwork = errors.New("network must be udp, tcp, tls or unixgram")
+
+type Sender struct {
+	network    string
+	addr       string
+	format     format.Format
+	framing    Framing
+	tlsConfig  *tls.Config
+	timeout    time.Duration
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	backoff    time.Duration
+	conn       net.Conn
+	mutex      sync.Mutex
+}
+
+//NewSender returns a new Sender for the given network (udp, tcp, tls or
+//unixgram) and address, the connection is established on the first Send
+func NewSender(network, addr string) (*Sender, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "tls", "unixgram":
+	default:
+		return nil, ErrUnknownNetwork
+	}
+
+	return &Sender{
+		network:    network,
+		addr:       addr,
+		format:     &format.RFC5424{},
+		retries:    defaultRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}, nil
+}
+
+//Sets the syslog format (RFC3164 or RFC5424 or RFC6587)
+func (s *Sender) SetFormat(f format.Format) {
+	s.format = f
+}
+
+//Sets the framing used over TCP and TLS, ignored by datagram networks
+func (s *Sender) SetFraming(framing Framing) {
+	s.framing = framing
+}
+
+//Sets the TLS configuration used by the tls network
+func (s *Sender) SetTLSConfig(config *tls.Config) {
+	s.tlsConfig = config
+}
+
+//Sets the dial and write timeout, zero means no timeout
+func (s *Sender) SetTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+//Sets how many times a failed Send reconnects before giving up
+func (s *Sender) SetRetries(retries int) {
+	s.retries = retries
+}
+
+//Sets the wait between reconnections, it doubles on every failed attempt
+//from min up to max
+func (s *Sender) SetBackoff(min, max time.Duration) {
+	s.minBackoff = min
+	s.maxBackoff = max
+}
+
+//Sends the message, reconnecting with backoff if the connection is broken
+func (s *Sender) Send(m *format.Message) error {
+	line, err := Encode(s.format, m)
+	if err != nil {
+		return err
+	}
+
+	frame := s.frame(line)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			s.wait()
+		}
+
+		if err = s.write(frame); err == nil {
+			s.backoff = 0
+			return nil
+		}
+
+		s.disconnect()
+		if attempt >= s.retries {
+			return err
+		}
+	}
+}
+
+//Closes the connection, the next Send opens a new one
+func (s *Sender) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.disconnect()
+}
+
+func (s *Sender) frame(line []byte) []byte {
+	if !s.isStream() {
+		return line
+	}
+
+	framing := s.framing
+	if framing == DefaultFraming {
+		framing = NonTransparentFraming
+		if _, ok := s.format.(*format.RFC6587); ok {
+			framing = OctetCountingFraming
+		}
+	}
+
+	if framing == OctetCountingFraming {
+		prefix := strconv.Itoa(len(line)) + " "
+		return append([]byte(prefix), line...)
+	}
+
+	return append(line, '\n')
+}
+
+func (s *Sender) isStream() bool {
+	switch s.network {
+	case "tcp", "tcp4", "tcp6", "tls":
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Sender) write(frame []byte) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	if s.timeout > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	}
+
+	_, err := s.conn.Write(frame)
+	return err
+}
+
+func (s *Sender) connect() error {
+	dialer := &net.Dialer{Timeout: s.timeout}
+
+	var conn net.Conn
+	var err error
+	if s.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(s.network, s.addr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	return nil
+}
+
+func (s *Sender) disconnect() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Sender) wait() {
+	if s.backoff < s.minBackoff {
+		s.backoff = s.minBackoff
+	}
+
+	time.Sleep(s.backoff)
+
+	s.backoff *= 2
+	if s.backoff > s.maxBackoff {
+		s.backoff = s.maxBackoff
+	}
+}
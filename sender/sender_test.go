@@ -0,0 +1,225 @@
+package sender
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+	"gopkg.in/mcuadros/go-syslog.v2/internal/testcert"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SenderSuite struct{}
+
+var _ = Suite(&SenderSuite{})
+
+var exampleMessage = &format.Message{
+	Facility:  4,
+	Severity:  2,
+	Timestamp: exampleTimestamp,
+	Hostname:  "mymachine.example.com",
+	AppName:   "su",
+	ProcID:    "1234",
+	MsgID:     "ID47",
+	StructuredData: []format.SDElement{
+		{ID: "origin", Params: []format.SDParam{{Name: "ip", Value: "192.0.2.1"}}},
+	},
+	Message: "'su root' failed for lonvick on /dev/pts/8",
+}
+
+func newServer(f format.Format, channel syslog.LogPartsChannel) *syslog.Server {
+	server := syslog.NewServer()
+	server.SetFormat(f)
+	server.SetHandler(syslog.NewChannelHandler(channel))
+	return server
+}
+
+func receive(c *C, channel syslog.LogPartsChannel) format.LogParts {
+	select {
+	case logParts := <-channel:
+		return logParts
+	case <-time.After(2 * time.Second):
+		c.Fatal("no message received")
+	}
+	return nil
+}
+
+func (s *SenderSuite) assertRFC5424(c *C, logParts format.LogParts) {
+	m := format.NewMessage(logParts)
+	c.Assert(m.Priority, Equals, 34)
+	c.Assert(m.Timestamp.Equal(exampleTimestamp), Equals, true)
+	c.Assert(m.Hostname, Equals, exampleMessage.Hostname)
+	c.Assert(m.AppName, Equals, exampleMessage.AppName)
+	c.Assert(m.ProcID, Equals, exampleMessage.ProcID)
+	c.Assert(m.MsgID, Equals, exampleMessage.MsgID)
+	c.Assert(m.StructuredData, DeepEquals, exampleMessage.StructuredData)
+	c.Assert(m.Message, Equals, exampleMessage.Message)
+}
+
+func (s *SenderSuite) TestUDP(c *C) {
+	channel := make(syslog.LogPartsChannel, 1)
+	server := newServer(syslog.RFC5424, channel)
+	c.Assert(server.ListenUDP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	sender, err := NewSender("udp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	defer sender.Close()
+	c.Assert(sender.Send(exampleMessage), IsNil)
+
+	s.assertRFC5424(c, receive(c, channel))
+}
+
+func (s *SenderSuite) TestTCPOctetCounting(c *C) {
+	channel := make(syslog.LogPartsChannel, 2)
+	server := newServer(syslog.RFC6587, channel)
+	c.Assert(server.ListenTCP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	sender, err := NewSender("tcp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	defer sender.Close()
+	sender.SetFormat(syslog.RFC6587)
+	c.Assert(sender.Send(exampleMessage), IsNil)
+	c.Assert(sender.Send(exampleMessage), IsNil)
+
+	s.assertRFC5424(c, receive(c, channel))
+	s.assertRFC5424(c, receive(c, channel))
+}
+
+func (s *SenderSuite) TestTCPNonTransparent(c *C) {
+	channel := make(syslog.LogPartsChannel, 1)
+	server := newServer(syslog.RFC3164, channel)
+	c.Assert(server.ListenTCP("127.0.0.1:0"), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	sender, err := NewSender("tcp", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	defer sender.Close()
+	sender.SetFormat(syslog.RFC3164)
+	c.Assert(sender.Send(&format.Message{
+		Facility: 1,
+		Severity: 5,
+		Hostname: "myhostname",
+		AppName:  "myprogram",
+		Message:  "ciao",
+	}), IsNil)
+
+	logParts := receive(c, channel)
+	c.Assert(logParts["hostname"], Equals, "myhostname")
+	c.Assert(logParts["tag"], Equals, "myprogram")
+	c.Assert(logParts["content"], Equals, "ciao")
+	c.Assert(logParts["priority"], Equals, 13)
+}
+
+func (s *SenderSuite) TestTLS(c *C) {
+	serverCertificate := testcert.SelfSigned(c, "localhost")
+	leaf, err := x509.ParseCertificate(serverCertificate.Certificate[0])
+	c.Assert(err, IsNil)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	channel := make(syslog.LogPartsChannel, 1)
+	server := newServer(syslog.RFC6587, channel)
+	c.Assert(server.ListenTCPTLS("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	sender, err := NewSender("tls", server.LocalAddrs()[0].String())
+	c.Assert(err, IsNil)
+	defer sender.Close()
+	sender.SetFormat(syslog.RFC6587)
+	sender.SetTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{testcert.SelfSigned(c)},
+		RootCAs:      roots,
+		ServerName:   "localhost",
+	})
+	c.Assert(sender.Send(exampleMessage), IsNil)
+
+	logParts := receive(c, channel)
+	s.assertRFC5424(c, logParts)
+	c.Assert(logParts["tls_peer"], Equals, "self-signed")
+}
+
+func (s *SenderSuite) TestUnixgram(c *C) {
+	dir, err := ioutil.TempDir("", "sender")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+
+	channel := make(syslog.LogPartsChannel, 1)
+	server := newServer(syslog.RFC5424, channel)
+	c.Assert(server.ListenUnixgram(path), IsNil)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	sender, err := NewSender("unixgram", path)
+	c.Assert(err, IsNil)
+	defer sender.Close()
+	c.Assert(sender.Send(exampleMessage), IsNil)
+
+	s.assertRFC5424(c, receive(c, channel))
+}
+
+func (s *SenderSuite) TestReconnect(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	sender, err := NewSender("tcp", addr)
+	c.Assert(err, IsNil)
+	defer sender.Close()
+	sender.SetRetries(10)
+	sender.SetBackoff(10*time.Millisecond, 100*time.Millisecond)
+
+	channel := make(syslog.LogPartsChannel, 1)
+	server := newServer(syslog.RFC5424, channel)
+	started := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		server.ListenTCP(addr)
+		server.Boot()
+		close(started)
+	}()
+	defer func() {
+		<-started
+		server.Kill()
+	}()
+
+	c.Assert(sender.Send(exampleMessage), IsNil)
+	s.assertRFC5424(c, receive(c, channel))
+}
+
+func (s *SenderSuite) TestRetriesExhausted(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	sender, err := NewSender("tcp", addr)
+	c.Assert(err, IsNil)
+	sender.SetRetries(2)
+	sender.SetBackoff(time.Millisecond, time.Millisecond)
+	c.Assert(sender.Send(exampleMessage), NotNil)
+}
+
+func (s *SenderSuite) TestUnknownNetwork(c *C) {
+	_, err := NewSender("sctp", "127.0.0.1:514")
+	c.Assert(err, Equals, ErrUnknownNetwork)
+}
@@ -2,11 +2,15 @@ package syslog
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"errors"
+	"io"
 	"net"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/mcuadros/go-syslog.v2/format"
@@ -22,6 +26,9 @@ var (
 const (
 	datagramChannelBufferSize = 10
 	datagramReadBufferSize    = 64 * 1024
+	// Time given to a peer to complete the TLS handshake, unless the read or
+	// idle timeout is shorter
+	tlsHandshakeTimeout = 10 * time.Second
 )
 
 // A function type which gets the TLS peer name from the connection. Can return
@@ -32,15 +39,55 @@ type Server struct {
 	listeners               []net.Listener
 	connections             []net.PacketConn
 	wait                    sync.WaitGroup
+	readers                 sync.WaitGroup
 	doneTcp                 chan bool
+	shutdown                chan struct{}
+	shutdownOnce            sync.Once
+	killOnce                sync.Once
+	activeConns             map[TimeoutCloser]struct{}
+	activeConnsMutex        sync.Mutex
 	datagramChannelSize     int
 	datagramChannel         chan DatagramMessage
+	datagramWorkers         int
+	preserveSourceOrder     bool
+	dropPolicy              DropPolicy
+	overflowFunc            OverflowFunc
+	metrics                 metrics
+	sources                 map[interface{}]*source
+	sourcesMutex            sync.RWMutex
 	format                  format.Format
 	handler                 Handler
+	typedHandler            TypedHandler
 	lastError               error
+	lastErrorMutex          sync.Mutex
+	errorHandler            ErrorHandler
+	includeMetadata         bool
+	transportErrorHandler   TransportErrorHandler
 	readTimeoutMilliseconds int64
+	shutdownTimeout         time.Duration
 	tlsPeerNameFunc         TlsPeerNameFunc
 	datagramPool            sync.Pool
+	maxMessageSize          int
+	oversizePolicy          OversizePolicy
+	maxConnections          int
+	maxConnectionsPerIP     int
+	idleTimeout             time.Duration
+	maxConnectionLifetime   time.Duration
+	connectionsMutex        sync.Mutex
+	admitted                map[net.Conn]string
+	connectionsPerIP        map[string]int
+	accessList              atomic.Value
+	reportDenied            bool
+	rateLimitMutex          sync.RWMutex
+	rateLimiter             *rateLimiter
+	rateLimitSummaryFunc    RateLimitSummaryFunc
+	rateLimitInterval       time.Duration
+	unixSocketMode          os.FileMode
+	unixSocketUid           int
+	unixSocketGid           int
+	peerCredentials         bool
+	processInfo             bool
+	proxyTrusted            []*net.IPNet
 }
 
 //NewServer returns a new Server
@@ -52,6 +99,16 @@ func NewServer() *Server {
 	},
 
 		datagramChannelSize: datagramChannelBufferSize,
+		datagramWorkers:     1,
+		shutdownTimeout:     DefaultShutdownTimeout,
+		doneTcp:             make(chan bool),
+		shutdown:            make(chan struct{}),
+		activeConns:         make(map[TimeoutCloser]struct{}),
+		sources:             make(map[interface{}]*source),
+		admitted:            make(map[net.Conn]string),
+		connectionsPerIP:    make(map[string]int),
+		unixSocketUid:       -1,
+		unixSocketGid:       -1,
 	}
 }
 
@@ -65,11 +122,28 @@ func (s *Server) SetHandler(handler Handler) {
 	s.handler = handler
 }
 
+//Sets the typed handler, this handler with receive every syslog entry as a
+//Message. It can be used alone or along with the Handler
+func (s *Server) SetTypedHandler(handler TypedHandler) {
+	s.typedHandler = handler
+}
+
 //Sets the connection timeout for TCP connections, in milliseconds
 func (s *Server) SetTimeout(millseconds int64) {
 	s.readTimeoutMilliseconds = millseconds
 }
 
+// Time given by Serve to the messages to drain, unless SetShutdownTimeout
+// changes it
+const DefaultShutdownTimeout = 30 * time.Second
+
+//Sets how long Serve waits, once its context is done, for the messages
+//already received to be handled before killing the server. Zero or less
+//waits as long as it takes
+func (s *Server) SetShutdownTimeout(timeout time.Duration) {
+	s.shutdownTimeout = timeout
+}
+
 // Set the function that extracts a TLS peer name from the TLS connection
 func (s *Server) SetTlsPeerNameFunc(tlsPeerNameFunc TlsPeerNameFunc) {
 	s.tlsPeerNameFunc = tlsPeerNameFunc
@@ -79,6 +153,18 @@ func (s *Server) SetDatagramChannelSize(size int) {
 	s.datagramChannelSize = size
 }
 
+//Sets how many go routines parse the UDP and unixgram datagrams, one by
+//default. With more than one the handler is called concurrently
+func (s *Server) SetDatagramWorkers(workers int) {
+	s.datagramWorkers = workers
+}
+
+//When enabled the datagrams of a given client address are always parsed by
+//the same worker, so they reach the handler in the order they were received
+func (s *Server) SetPreserveSourceOrder(preserve bool) {
+	s.preserveSourceOrder = preserve
+}
+
 // Default TLS peer name function - returns the CN of the certificate
 func defaultTlsPeerName(tlsConn *tls.Conn) (tlsPeer string, ok bool) {
 	state := tlsConn.ConnectionState()
@@ -100,10 +186,8 @@ func (s *Server) ListenUDP(addr string) error {
 	if err != nil {
 		return err
 	}
-	connection.SetReadBuffer(datagramReadBufferSize)
 
-	s.connections = append(s.connections, connection)
-	return nil
+	return s.addPacketConn(connection, addr)
 }
 
 //Configure the server for listen on an unix socket
@@ -117,9 +201,17 @@ func (s *Server) ListenUnixgram(addr string) error {
 	if err != nil {
 		return err
 	}
-	connection.SetReadBuffer(datagramReadBufferSize)
 
-	s.connections = append(s.connections, connection)
+	if err := s.setSocketPermissions(addr); err != nil {
+		connection.Close()
+		return err
+	}
+
+	if err := s.addPacketConn(connection, addr); err != nil {
+		connection.Close()
+		return err
+	}
+
 	return nil
 }
 
@@ -135,30 +227,51 @@ func (s *Server) ListenTCP(addr string) error {
 		return err
 	}
 
-	s.doneTcp = make(chan bool)
-	s.listeners = append(s.listeners, listener)
+	if err := s.addListener(listener, addr, "tcp"); err != nil {
+		listener.Close()
+		return err
+	}
+
 	return nil
 }
 
 //Configure the server for listen on a TCP addr for TLS
 func (s *Server) ListenTCPTLS(addr string, config *tls.Config) error {
-	listener, err := tls.Listen("tcp", addr, config)
+	listener, proxy, err := s.listenTLS(addr, config)
 	if err != nil {
 		return err
 	}
 
-	s.doneTcp = make(chan bool)
-	s.listeners = append(s.listeners, listener)
+	if err := s.addListener(listener, addr, "tls"); err != nil {
+		listener.Close()
+		return err
+	}
+	s.sources[listener].proxy = proxy
+
 	return nil
 }
 
+//Returns the addresses the server listens on, TCP listeners first
+func (s *Server) LocalAddrs() []net.Addr {
+	var addrs []net.Addr
+	for _, listener := range s.listeners {
+		addrs = append(addrs, listener.Addr())
+	}
+
+	for _, connection := range s.connections {
+		addrs = append(addrs, connection.LocalAddr())
+	}
+
+	return addrs
+}
+
 //Starts the server, all the go routines goes to live
 func (s *Server) Boot() error {
 	if s.format == nil {
 		return errors.New("please set a valid format")
 	}
 
-	if s.handler == nil {
+	if s.handler == nil && s.typedHandler == nil {
 		return errors.New("please set a valid handler")
 	}
 
@@ -174,68 +287,214 @@ func (s *Server) Boot() error {
 		s.goReceiveDatagrams(connection)
 	}
 
+	s.goSummarizeRateLimits()
+
 	return nil
 }
 
+func (s *Server) addSource(key interface{}, name, listener, transport string) {
+	src := s.metrics.get(listener, transport)
+	src.address = name
+
+	s.sourcesMutex.Lock()
+	defer s.sourcesMutex.Unlock()
+
+	s.sources[key] = src
+}
+
+// Returns the source of a listener or packet connection, creating it from
+// its address if it was not opened by the server
+func (s *Server) sourceOf(key interface{}, addr net.Addr) *source {
+	s.sourcesMutex.RLock()
+	src, ok := s.sources[key]
+	s.sourcesMutex.RUnlock()
+
+	if ok {
+		return src
+	}
+
+	if addr == nil {
+		return s.metrics.get("", "")
+	}
+
+	return s.metrics.get(addr.String(), addr.Network())
+}
+
 func (s *Server) goAcceptConnection(listener net.Listener) {
+	src := s.sourceOf(listener, listener.Addr())
+
 	s.wait.Add(1)
 	go func(listener net.Listener) {
 	loop:
 		for {
 			select {
-			case <-s.doneTcp:
+			case <-s.shutdown:
 				break loop
 			default:
 			}
 			connection, err := listener.Accept()
 			if err != nil {
+				select {
+				case <-s.shutdown:
+					break loop
+				default:
+				}
+				s.reportTransportError(err, OpAccept, "", src)
+				backoffTemporary()
 				continue
 			}
 
-			s.goScanConnection(connection)
+			atomic.AddUint64(&src.connections, 1)
+			s.wait.Add(1)
+			go s.acceptConnection(connection, src)
 		}
 
 		s.wait.Done()
 	}(listener)
 }
 
+// Reads the PROXY protocol header of an accepted connection, if any, and
+// applies the access lists and connection limits before scanning it. Done on
+// a goroutine of its own so a slow peer does not hold up the listener
+func (s *Server) acceptConnection(connection net.Conn, src *source) {
+	defer s.wait.Done()
+
+	// Tracked until scanned so the server can stop it meanwhile
+	s.activeConnsMutex.Lock()
+	s.activeConns[connection] = struct{}{}
+	s.activeConnsMutex.Unlock()
+
+	defer func(raw net.Conn) {
+		s.activeConnsMutex.Lock()
+		delete(s.activeConns, raw)
+		s.activeConnsMutex.Unlock()
+	}(connection)
+
+	if src.proxy != nil {
+		var err error
+		if connection, err = s.acceptProxy(connection, src.proxy); err != nil {
+			s.reportTransportError(err, OpProxy, connection.RemoteAddr().String(), src)
+			connection.Close()
+			return
+		}
+	}
+	if !s.permitted(connection.RemoteAddr(), src) {
+		connection.Close()
+		return
+	}
+
+	if s.admit(connection, src) {
+		s.scanSourceConnection(connection, src)
+	}
+}
+
 func (s *Server) goScanConnection(connection net.Conn) {
-	scanner := bufio.NewScanner(connection)
-	if sf := s.format.GetSplitFunc(); sf != nil {
-		scanner.Split(sf)
+	transport := ""
+	if _, ok := connection.(*tls.Conn); ok {
+		transport = "tls"
+	} else if addr := connection.LocalAddr(); addr != nil {
+		transport = addr.Network()
 	}
 
+	listener := ""
+	if addr := connection.LocalAddr(); addr != nil {
+		listener = addr.String()
+	}
+
+	s.goScanSourceConnection(connection, s.metrics.get(listener, transport))
+}
+
+func (s *Server) goScanSourceConnection(connection net.Conn, src *source) {
+	s.wait.Add(1)
+	go func() {
+		s.scanSourceConnection(connection, src)
+		s.wait.Done()
+	}()
+}
+
+func (s *Server) scanSourceConnection(connection net.Conn, src *source) {
 	remoteAddr := connection.RemoteAddr()
 	var client string
 	if remoteAddr != nil {
 		client = remoteAddr.String()
 	}
 
+	limiter := s.newFrameLimiter(src, func() {
+		s.reportTransportError(ErrFrameTooLarge, OpFrame, client, src)
+	})
+
+	var localAddr string
+	if addr := connection.LocalAddr(); addr != nil {
+		localAddr = addr.String()
+	}
+
+	var credentials *peerCredentials
+	if unixConn, ok := connection.(*net.UnixConn); ok && src.credentials {
+		var err error
+		if credentials, err = connectionCredentials(unixConn); err != nil {
+			s.reportTransportError(err, OpAccept, client, src)
+		}
+	}
+
 	tlsPeer := ""
 	if tlsConn, ok := connection.(*tls.Conn); ok {
 		// Handshake now so we get the TLS peer information
-		if err := tlsConn.Handshake(); err != nil {
+		s.setAcceptDeadline(connection, s.handshakeTimeout())
+		err := tlsConn.Handshake()
+		s.setAcceptDeadline(connection, 0)
+		if errors.Is(err, errTlsPeerRejected) {
+			// Refused by the peer authorization of an RFC5425 listener
+			s.reportTransportError(err, OpPeer, client, src)
 			connection.Close()
+			s.release(connection)
 			return
 		}
-		if s.tlsPeerNameFunc != nil {
+		if err != nil {
+			s.reportTransportError(err, OpHandshake, client, src)
+			connection.Close()
+			s.release(connection)
+			return
+		}
+		if src.peers != nil || s.tlsPeerNameFunc != nil {
 			var ok bool
-			tlsPeer, ok = s.tlsPeerNameFunc(tlsConn)
+			if src.peers != nil {
+				tlsPeer, ok = src.peers.peer(tlsConn.ConnectionState())
+			} else {
+				tlsPeer, ok = s.tlsPeerNameFunc(tlsConn)
+			}
 			if !ok {
+				s.reportTransportError(errTlsPeerRejected, OpPeer, client, src)
 				connection.Close()
+				s.release(connection)
 				return
 			}
 		}
 	}
 
+	connection = s.limitConnection(connection)
+
+	scanner := bufio.NewScanner(connection)
+	scanner.Buffer(nil, limiter.bufferSize())
+	scanner.Split(limiter.Split)
+
 	var scanCloser *ScanCloser
-	scanCloser = &ScanCloser{scanner, connection}
+	scanCloser = &ScanCloser{scanner, connection, limiter}
 
-	s.wait.Add(1)
-	go s.scan(scanCloser, client, tlsPeer)
+	s.activeConnsMutex.Lock()
+	s.activeConns[connection] = struct{}{}
+	s.activeConnsMutex.Unlock()
+
+	s.scan(scanCloser, origin{client, tlsPeer, localAddr, src, credentials})
 }
 
-func (s *Server) scan(scanCloser *ScanCloser, client string, tlsPeer string) {
+var errTlsPeerRejected = errors.New("TLS peer rejected")
+
+func (s *Server) scan(scanCloser *ScanCloser, o origin) {
+	var session *relpSession
+	if o.source.relp {
+		session = &relpSession{writer: scanCloser.closer.(io.Writer)}
+	}
+
 loop:
 	for {
 		select {
@@ -243,69 +502,368 @@ loop:
 			break loop
 		default:
 		}
-		if s.readTimeoutMilliseconds > 0 {
-			scanCloser.closer.SetReadDeadline(time.Now().Add(time.Duration(s.readTimeoutMilliseconds) * time.Millisecond))
-		}
+		s.setReadDeadline(scanCloser.closer)
 		if scanCloser.Scan() {
-			s.parser([]byte(scanCloser.Text()), client, tlsPeer)
+			line := append([]byte(nil), scanCloser.Bytes()...)
+			atomic.AddUint64(&o.source.bytes, uint64(len(line)))
+			if session == nil {
+				s.parser(line, o, s.receiveTime(), scanCloser.limiter.truncated)
+				continue
+			}
+
+			switch err := s.relpCommand(session, line, o); {
+			case err == nil:
+				continue
+			case err == ErrRELPFrame:
+				s.reportTransportError(err, OpFrame, o.client, o.source)
+			case err != errRELPClosed:
+				s.reportTransportError(err, OpRead, o.client, o.source)
+			}
+			break loop
 		} else {
+			switch err := scanCloser.Err(); {
+			case err == nil, err == ErrFrameTooLarge, s.isShuttingDown():
+			case err == ErrNotOctetCounted, err == ErrRELPFrame:
+				s.reportTransportError(err, OpFrame, o.client, o.source)
+			case err == ErrIdleTimeout:
+				atomic.AddUint64(&o.source.idleClosed, 1)
+				s.reportTransportError(err, OpLimit, o.client, o.source)
+			case err == ErrConnectionLifetime:
+				atomic.AddUint64(&o.source.lifetimeClosed, 1)
+				s.reportTransportError(err, OpLimit, o.client, o.source)
+			default:
+				s.reportTransportError(err, OpRead, o.client, o.source)
+			}
 			break loop
 		}
 	}
 	scanCloser.closer.Close()
 
-	s.wait.Done()
+	s.activeConnsMutex.Lock()
+	delete(s.activeConns, scanCloser.closer)
+	s.activeConnsMutex.Unlock()
+
+	if conn, ok := scanCloser.closer.(net.Conn); ok {
+		s.release(conn)
+	}
+}
+
+func (s *Server) isShuttingDown() bool {
+	select {
+	case <-s.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// setReadDeadline arms the read timeout before every frame. Once the server is
+// shutting down the deadline is set in the past instead, so the scanner hands
+// out the frames it has already buffered and then stops.
+func (s *Server) setReadDeadline(closer TimeoutCloser) {
+	s.activeConnsMutex.Lock()
+	defer s.activeConnsMutex.Unlock()
+
+	select {
+	case <-s.shutdown:
+		closer.SetReadDeadline(time.Now())
+	default:
+		if s.readTimeoutMilliseconds > 0 {
+			closer.SetReadDeadline(time.Now().Add(time.Duration(s.readTimeoutMilliseconds) * time.Millisecond))
+		}
+	}
+}
+
+// Arms, or clears given a zero timeout, the deadline of the steps preceding
+// the frames: reading the PROXY protocol header and the TLS handshake. Once
+// the server is shutting down the deadline is set in the past instead
+func (s *Server) setAcceptDeadline(connection net.Conn, timeout time.Duration) {
+	s.activeConnsMutex.Lock()
+	defer s.activeConnsMutex.Unlock()
+
+	switch {
+	case s.isShuttingDown():
+		connection.SetDeadline(time.Now())
+	case timeout > 0:
+		connection.SetDeadline(time.Now().Add(timeout))
+	default:
+		connection.SetDeadline(time.Time{})
+	}
+}
+
+// Returns the time given to the TLS handshake, the shortest of the default
+// and the read and idle timeouts
+func (s *Server) handshakeTimeout() time.Duration {
+	timeout := tlsHandshakeTimeout
+	if s.readTimeoutMilliseconds > 0 && time.Duration(s.readTimeoutMilliseconds)*time.Millisecond < timeout {
+		timeout = time.Duration(s.readTimeoutMilliseconds) * time.Millisecond
+	}
+	if s.idleTimeout > 0 && s.idleTimeout < timeout {
+		timeout = s.idleTimeout
+	}
+
+	return timeout
+}
+
+// Where a message comes from
+type origin struct {
+	client      string
+	tlsPeer     string
+	localAddr   string
+	source      *source
+	credentials *peerCredentials
 }
 
-func (s *Server) parser(line []byte, client string, tlsPeer string) {
+//Adds to every message the raw frame bytes and where and when it was received:
+//raw, received_at, transport, local_addr and listener. The raw bytes are the
+//message as handed to the parser, not as received: the trailing control
+//characters and NULs of a datagram are trimmed, a stream frame comes without
+//its newline, octet count or RELP header and a connection without its PROXY
+//protocol header. A truncated frame holds its first bytes only
+func (s *Server) SetIncludeMetadata(include bool) {
+	s.includeMetadata = include
+}
+
+//Sets the name of the listeners created for the given address, as given to
+//the Listen methods. The name labels their messages, counters and errors, by
+//default it is the address the listener is bound to. It can be replaced while
+//the server runs. Returns ErrUnknownListener when no listener was created for
+//addr
+func (s *Server) SetListenerName(addr string, name string) error {
+	sources, err := s.sourcesOf(addr)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range sources {
+		src.setName(name)
+	}
+
+	return nil
+}
+
+// Returned by the per listener settings for an address no listener was
+// created for
+var ErrUnknownListener = errors.New("no listener for the given address")
+
+// Returns the sources of the listeners created for the given address
+func (s *Server) sourcesOf(addr string) ([]*source, error) {
+	s.sourcesMutex.RLock()
+	defer s.sourcesMutex.RUnlock()
+
+	var sources []*source
+	for _, src := range s.sources {
+		if src.address == addr {
+			sources = append(sources, src)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil, ErrUnknownListener
+	}
+
+	return sources, nil
+}
+
+// The receive time is only needed, and so only taken, with the metadata
+func (s *Server) receiveTime() time.Time {
+	if s.includeMetadata {
+		return time.Now()
+	}
+
+	return time.Time{}
+}
+
+// Parses and delivers one message, reporting whether it reached the handlers
+func (s *Server) parser(line []byte, o origin, receivedAt time.Time, truncated bool) bool {
+	if o.source == nil {
+		o.source = s.metrics.get("", "")
+	}
+	src := o.source
+	client := o.client
+
 	parser := s.format.GetParser(line)
 	err := parser.Parse()
 	if err != nil {
-		s.lastError = err
+		offset := -1
+		if p, ok := parser.(format.OffsetParser); ok {
+			offset = p.Offset()
+		}
+		s.reportParseError(err, line, client, src, offset)
 	}
 
 	logParts := parser.Dump()
+	if pool, ok := s.format.(format.ParserPool); ok {
+		pool.PutParser(parser)
+	}
+
 	logParts["client"] = client
-	if logParts["hostname"] == "" && (s.format == RFC3164 || s.format == Automatic) {
+	switch s.format.(type) {
+	case *format.RFC3164, *format.Automatic:
+		if logParts["hostname"] != "" {
+			break
+		}
 		if i := strings.Index(client, ":"); i > 1 {
 			logParts["hostname"] = client[:i]
 		} else {
 			logParts["hostname"] = client
 		}
 	}
-	logParts["tls_peer"] = tlsPeer
+	logParts["tls_peer"] = o.tlsPeer
+	s.addCredentials(logParts, o.credentials)
+	if truncated {
+		logParts["truncated"] = true
+	}
+
+	if s.includeMetadata {
+		logParts["raw"] = append([]byte(nil), line...)
+		logParts["received_at"] = receivedAt
+		logParts["transport"] = src.transport
+		logParts["local_addr"] = o.localAddr
+		logParts["listener"] = src.name()
+	}
+
+	if limiter := s.rateLimiterOf(src); limiter != nil {
+		deliver, limited := limiter.allow(client, logParts)
+		if !deliver {
+			return false
+		}
+		if limited {
+			logParts["rate_limited"] = true
+		}
+	}
+
+	counters := src.format(formatName(s.format, logParts))
+	start := time.Now()
+
+	if s.typedHandler != nil {
+		message := format.NewMessage(logParts)
+		// The metadata already holds a copy of the frame
+		if message.Raw == nil {
+			message.Raw = append([]byte(nil), line...)
+		}
+		s.typedHandler.HandleMessage(message, int64(len(line)), err)
+	}
+
+	if s.handler != nil {
+		s.handler.Handle(logParts, int64(len(line)), err)
+	}
 
-	s.handler.Handle(logParts, int64(len(line)), err)
+	counters.observe(time.Since(start), err)
+	return true
 }
 
-//Returns the last error
+//Returns the last parse error, see SetErrorHandler to get all of them
 func (s *Server) GetLastError() error {
+	s.lastErrorMutex.Lock()
+	defer s.lastErrorMutex.Unlock()
+
 	return s.lastError
 }
 
-//Kill the server
+//Kill the server, in-flight frames and queued datagrams may be lost
 func (s *Server) Kill() error {
-	for _, connection := range s.connections {
-		err := connection.Close()
-		if err != nil {
-			return err
-		}
-	}
+	err := s.stopListening()
 
-	for _, listener := range s.listeners {
-		err := listener.Close()
-		if err != nil {
-			return err
-		}
-	}
 	// Only need to close channel once to broadcast to all waiting
-	if s.doneTcp != nil {
+	s.killOnce.Do(func() {
 		close(s.doneTcp)
+	})
+
+	s.activeConnsMutex.Lock()
+	for conn := range s.activeConns {
+		conn.Close()
+	}
+	s.activeConnsMutex.Unlock()
+
+	return err
+}
+
+// Shutdown gracefully stops the server: listeners stop accepting, every TCP
+// connection delivers the frames it has already received and the queued
+// datagrams go through the Handler. If ctx is done before that, the server is
+// killed and the context error returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.stopListening()
+
+	s.activeConnsMutex.Lock()
+	for conn := range s.activeConns {
+		conn.SetReadDeadline(time.Now())
 	}
-	if s.datagramChannel != nil {
-		close(s.datagramChannel)
+	s.activeConnsMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.Kill()
+		return ctx.Err()
 	}
-	return nil
+}
+
+// Serve boots the server and blocks until ctx is done, then shuts it down
+// gracefully, killing it with context.DeadlineExceeded past the shutdown
+// timeout. It returns earlier if the server is stopped by other means.
+func (s *Server) Serve(ctx context.Context) error {
+	if err := s.Boot(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		shutdownCtx := context.Background()
+		if s.shutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.shutdownTimeout)
+			defer cancel()
+		}
+		return s.Shutdown(shutdownCtx)
+	}
+}
+
+// stopListening closes every socket so no new input is accepted, returning the
+// first error found. The datagram channel is closed once all the readers are
+// gone, never before, so nobody sends on a closed channel.
+func (s *Server) stopListening() error {
+	var err error
+	s.shutdownOnce.Do(func() {
+		close(s.shutdown)
+
+		for _, connection := range s.connections {
+			if e := connection.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+
+		for _, listener := range s.listeners {
+			if e := listener.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+
+		go func() {
+			s.readers.Wait()
+			if s.datagramChannel != nil {
+				close(s.datagramChannel)
+			}
+		}()
+	})
+
+	return err
 }
 
 //Waits until the server stops
@@ -320,22 +878,49 @@ type TimeoutCloser interface {
 
 type ScanCloser struct {
 	*bufio.Scanner
-	closer TimeoutCloser
+	closer  TimeoutCloser
+	limiter *frameLimiter
 }
 
 type DatagramMessage struct {
-	message []byte
-	client  string
+	message     []byte
+	client      string
+	source      *source
+	receivedAt  time.Time
+	credentials *peerCredentials
 }
 
 func (s *Server) goReceiveDatagrams(packetconn net.PacketConn) {
+	src := s.sourceOf(packetconn, packetconn.LocalAddr())
+
 	s.wait.Add(1)
+	s.readers.Add(1)
 	go func() {
 		defer s.wait.Done()
+		defer s.readers.Done()
+
+		// The unix datagrams are read along with the credentials of their sender
+		read := func(buf []byte) (int, net.Addr, *peerCredentials, error) {
+			n, addr, err := packetconn.ReadFrom(buf)
+			return n, addr, nil, err
+		}
+		if unixConn, ok := packetconn.(*net.UnixConn); ok && src.credentials {
+			oob := make([]byte, credentialsBufferSize)
+			read = func(buf []byte) (int, net.Addr, *peerCredentials, error) {
+				return readWithCredentials(unixConn, buf, oob)
+			}
+		}
+
 		for {
 			buf := s.datagramPool.Get().([]byte)
-			n, addr, err := packetconn.ReadFrom(buf)
+			n, addr, credentials, err := read(buf)
 			if err == nil {
+				atomic.AddUint64(&src.datagrams, 1)
+				atomic.AddUint64(&src.bytes, uint64(n))
+				if !s.permitted(addr, src) {
+					s.datagramPool.Put(buf)
+					continue
+				}
 				// Ignore trailing control characters and NULs
 				for ; (n > 0) && (buf[n-1] < 32); n-- {
 				}
@@ -344,7 +929,7 @@ func (s *Server) goReceiveDatagrams(packetconn net.PacketConn) {
 					if addr != nil {
 						address = addr.String()
 					}
-					s.datagramChannel <- DatagramMessage{buf[:n], address}
+					s.enqueueDatagram(DatagramMessage{buf[:n], address, src, s.receiveTime(), credentials})
 				}
 			} else {
 				// there has been an error. Either the server has been killed
@@ -354,7 +939,8 @@ func (s *Server) goReceiveDatagrams(packetconn net.PacketConn) {
 				if (ok) && !opError.Temporary() && !opError.Timeout() {
 					return
 				}
-				time.Sleep(10 * time.Millisecond)
+				s.reportTransportError(err, OpRead, "", src)
+				backoffTemporary()
 			}
 		}
 	}()
@@ -363,24 +949,71 @@ func (s *Server) goReceiveDatagrams(packetconn net.PacketConn) {
 func (s *Server) goParseDatagrams() {
 	s.datagramChannel = make(chan DatagramMessage, s.datagramChannelSize)
 
+	workers := s.datagramWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	if workers == 1 || !s.preserveSourceOrder {
+		for i := 0; i < workers; i++ {
+			s.goParseDatagramChannel(s.datagramChannel)
+		}
+		return
+	}
+
+	channels := make([]chan DatagramMessage, workers)
+	for i := range channels {
+		channels[i] = make(chan DatagramMessage, s.datagramChannelSize)
+		s.goParseDatagramChannel(channels[i])
+	}
+
+	s.wait.Add(1)
+	go func() {
+		defer s.wait.Done()
+		for msg := range s.datagramChannel {
+			channels[hashClient(msg.client)%uint32(workers)] <- msg
+		}
+
+		for _, channel := range channels {
+			close(channel)
+		}
+	}()
+}
+
+func (s *Server) goParseDatagramChannel(channel chan DatagramMessage) {
 	s.wait.Add(1)
 	go func() {
 		defer s.wait.Done()
 		for {
 			select {
-			case msg, ok := (<-s.datagramChannel):
+			case msg, ok := (<-channel):
 				if !ok {
 					return
 				}
+				o := origin{client: msg.client, source: msg.source, credentials: msg.credentials}
+				if msg.source != nil {
+					o.localAddr = msg.source.listener
+				}
 				if sf := s.format.GetSplitFunc(); sf != nil {
 					if _, token, err := sf(msg.message, true); err == nil {
-						s.parser(token, msg.client, "")
+						s.parser(token, o, msg.receivedAt, false)
 					}
 				} else {
-					s.parser(msg.message, msg.client, "")
+					s.parser(msg.message, o, msg.receivedAt, false)
 				}
 				s.datagramPool.Put(msg.message[:cap(msg.message)])
 			}
 		}
 	}()
 }
+
+// FNV-1a, inlined to not allocate for every datagram
+func hashClient(client string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(client); i++ {
+		hash ^= uint32(client[i])
+		hash *= 16777619
+	}
+
+	return hash
+}
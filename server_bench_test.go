@@ -2,8 +2,11 @@ package syslog
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"net"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -43,6 +46,18 @@ func (s *handlerCounter) Handle(logParts format.LogParts, msgLen int64, err erro
 	}
 }
 
+type handlerAtomicCounter struct {
+	expected int64
+	current  int64
+	done     chan struct{}
+}
+
+func (s *handlerAtomicCounter) Handle(logParts format.LogParts, msgLen int64, err error) {
+	if atomic.AddInt64(&s.current, 1) == s.expected {
+		close(s.done)
+	}
+}
+
 type fakePacketConn struct {
 	*io.PipeReader
 }
@@ -81,6 +96,7 @@ func BenchmarkDatagramNoFormatting(b *testing.B) {
 	server.goParseDatagrams()
 	msg := []byte(exampleSyslog + "\n")
 	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		writer.Write(msg)
 	}
@@ -98,8 +114,95 @@ func BenchmarkTCPNoFormatting(b *testing.B) {
 	conn, _ := net.DialTimeout("tcp", server.listeners[0].Addr().String(), time.Second)
 	msg := []byte(exampleSyslog + "\n")
 	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		conn.Write(msg)
 	}
 	<-handler.done
 }
+
+func benchmarkDatagramWorkers(b *testing.B, workers int, preserveSourceOrder bool) {
+	handler := &handlerAtomicCounter{expected: int64(b.N), done: make(chan struct{})}
+	server := NewServer()
+	server.SetFormat(Automatic)
+	server.SetHandler(handler)
+	server.SetDatagramChannelSize(1024)
+	server.SetDatagramWorkers(workers)
+	server.SetPreserveSourceOrder(preserveSourceOrder)
+	server.goParseDatagrams()
+
+	clients := make([]string, 64)
+	for i := range clients {
+		clients[i] = fmt.Sprintf("10.0.0.%d:514", i)
+	}
+
+	msg := []byte(exampleRFC5424Syslog)
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := server.datagramPool.Get().([]byte)
+		n := copy(buf, msg)
+		server.datagramChannel <- DatagramMessage{message: buf[:n], client: clients[i%len(clients)]}
+	}
+	<-handler.done
+	b.StopTimer()
+	close(server.datagramChannel)
+	server.Wait()
+}
+
+func BenchmarkDatagramWorkers1(b *testing.B) {
+	benchmarkDatagramWorkers(b, 1, false)
+}
+
+func BenchmarkDatagramWorkers4(b *testing.B) {
+	benchmarkDatagramWorkers(b, 4, false)
+}
+
+func BenchmarkDatagramWorkersNumCPU(b *testing.B) {
+	benchmarkDatagramWorkers(b, runtime.NumCPU(), false)
+}
+
+func BenchmarkDatagramWorkersNumCPUPreserveSourceOrder(b *testing.B) {
+	benchmarkDatagramWorkers(b, runtime.NumCPU(), true)
+}
+
+// Parses and handles a message of the given format, run with -benchmem for
+// the allocations of each format
+func benchmarkParser(b *testing.B, f format.Format, msg string) {
+	handler := &handlerCounter{expected: b.N, done: make(chan struct{})}
+	server := NewServer()
+	server.SetFormat(f)
+	server.SetHandler(handler)
+	o := origin{client: "10.0.0.1:514", source: server.metrics.get("127.0.0.1:514", "udp")}
+
+	line := []byte(msg)
+	receivedAt := time.Now()
+	b.SetBytes(int64(len(line)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		server.parser(line, o, receivedAt, false)
+	}
+	<-handler.done
+}
+
+func BenchmarkParserRFC3164(b *testing.B) {
+	benchmarkParser(b, RFC3164, exampleSyslog)
+}
+
+func BenchmarkParserRFC5424(b *testing.B) {
+	benchmarkParser(b, RFC5424, exampleRFC5424Syslog)
+}
+
+func BenchmarkParserRFC6587(b *testing.B) {
+	benchmarkParser(b, RFC6587, exampleRFC5424Syslog)
+}
+
+func BenchmarkParserAutomaticRFC3164(b *testing.B) {
+	benchmarkParser(b, Automatic, exampleSyslog)
+}
+
+func BenchmarkParserAutomaticRFC5424(b *testing.B) {
+	benchmarkParser(b, Automatic, exampleRFC5424Syslog)
+}
@@ -1,9 +1,11 @@
 package syslog
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -68,6 +70,7 @@ type ConnMock struct {
 	ReturnTimeout  bool
 	isClosed       bool
 	isReadDeadline bool
+	mutex          sync.Mutex
 }
 
 func (c *ConnMock) Read(b []byte) (n int, err error) {
@@ -76,7 +79,10 @@ func (c *ConnMock) Read(b []byte) (n int, err error) {
 	}
 	if c.ReadData != nil {
 		l := copy(b, c.ReadData)
-		c.ReadData = nil
+		c.ReadData = c.ReadData[l:]
+		if len(c.ReadData) == 0 {
+			c.ReadData = nil
+		}
 		return l, nil
 	}
 	return 0, io.EOF
@@ -87,6 +93,8 @@ func (c *ConnMock) Write(b []byte) (n int, err error) {
 }
 
 func (c *ConnMock) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.isClosed = true
 	return nil
 }
@@ -158,7 +166,7 @@ func (s *ServerSuite) TestUDP3164(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleSyslog), client: "0.0.0.0"}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "hostname")
@@ -175,7 +183,7 @@ func (s *ServerSuite) TestUDP3164NoTag(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslogNoTSTagHost), "127.0.0.1:45789"}
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleSyslogNoTSTagHost), client: "127.0.0.1:45789"}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "127.0.0.1")
@@ -185,6 +193,18 @@ func (s *ServerSuite) TestUDP3164NoTag(c *C) {
 	c.Check(handler.LastError, IsNil)
 }
 
+func (s *ServerSuite) TestUDP3164NoHostConfiguredFormat(c *C) {
+	handler := new(HandlerMock)
+	server := NewServer()
+	server.SetFormat(&format.RFC3164{Layouts: format.RFC3164Layouts})
+	server.SetHandler(handler)
+	server.goParseDatagrams()
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleSyslogNoTSTagHost), client: "127.0.0.1:45789"}
+	close(server.datagramChannel)
+	server.Wait()
+	c.Check(handler.LastLogParts["hostname"], Equals, "127.0.0.1")
+}
+
 func (s *ServerSuite) TestUDPAutomatic3164NoPriority(c *C) {
 	handler := new(HandlerMock)
 	server := NewServer()
@@ -192,7 +212,7 @@ func (s *ServerSuite) TestUDPAutomatic3164NoPriority(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslogNoPriority), "127.0.0.1:45789"}
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleSyslogNoPriority), client: "127.0.0.1:45789"}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "127.0.0.1")
@@ -211,7 +231,7 @@ func (s *ServerSuite) TestUDP6587(c *C) {
 	server.SetTimeout(10)
 	server.goParseDatagrams()
 	framedSyslog := []byte(fmt.Sprintf("%d %s", len(exampleRFC5424Syslog), exampleRFC5424Syslog))
-	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{message: []byte(framedSyslog), client: "0.0.0.0"}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "mymachine.example.com")
@@ -228,7 +248,7 @@ func (s *ServerSuite) TestUDPAutomatic3164(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleSyslog), client: "0.0.0.0"}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "hostname")
@@ -245,7 +265,7 @@ func (s *ServerSuite) TestUDPAutomatic5424(c *C) {
 	server.SetHandler(handler)
 	server.SetTimeout(10)
 	server.goParseDatagrams()
-	server.datagramChannel <- DatagramMessage{[]byte(exampleRFC5424Syslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleRFC5424Syslog), client: "0.0.0.0"}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "mymachine.example.com")
@@ -263,7 +283,7 @@ func (s *ServerSuite) TestUDPAutomatic3164Plus6587OctetCount(c *C) {
 	server.SetTimeout(10)
 	server.goParseDatagrams()
 	framedSyslog := []byte(fmt.Sprintf("%d %s", len(exampleSyslog), exampleSyslog))
-	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{message: []byte(framedSyslog), client: "0.0.0.0"}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "hostname")
@@ -281,7 +301,7 @@ func (s *ServerSuite) TestUDPAutomatic5424Plus6587OctetCount(c *C) {
 	server.SetTimeout(10)
 	server.goParseDatagrams()
 	framedSyslog := []byte(fmt.Sprintf("%d %s", len(exampleRFC5424Syslog), exampleRFC5424Syslog))
-	server.datagramChannel <- DatagramMessage{[]byte(framedSyslog), "0.0.0.0"}
+	server.datagramChannel <- DatagramMessage{message: []byte(framedSyslog), client: "0.0.0.0"}
 	close(server.datagramChannel)
 	server.Wait()
 	c.Check(handler.LastLogParts["hostname"], Equals, "mymachine.example.com")
@@ -345,3 +365,281 @@ func (s *ServerSuite) TestTCPRace(c *C) {
 	<-handler.done
 	c.Check(handler.contents, DeepEquals, []string{"content1", "content2", "content3"})
 }
+
+func (s *ServerSuite) TestShutdownDrainsDatagrams(c *C) {
+	handler := &handlerSlow{handlerCounter: &handlerCounter{expected: 3, done: make(chan struct{})}}
+	server := NewServer()
+	server.SetFormat(Automatic)
+	server.SetHandler(handler)
+	server.ListenUDP("127.0.0.1:0")
+	server.Boot()
+	conn, err := net.Dial("udp", server.connections[0].LocalAddr().String())
+	c.Assert(err, IsNil)
+	for i := 1; i <= 3; i++ {
+		_, err = conn.Write([]byte(fmt.Sprintf("%s%d", exampleSyslog, i)))
+		c.Assert(err, IsNil)
+	}
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.Assert(server.Shutdown(ctx), IsNil)
+	c.Check(handler.contents, DeepEquals, []string{"content1", "content2", "content3"})
+}
+
+func (s *ServerSuite) TestShutdownDrainsTCP(c *C) {
+	handler := &handlerSlow{handlerCounter: &handlerCounter{expected: 3, done: make(chan struct{})}}
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.ListenTCP("127.0.0.1:0")
+	server.Boot()
+	conn, err := net.Dial("tcp", server.listeners[0].Addr().String())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	_, err = conn.Write([]byte(exampleSyslog + "1\n" + exampleSyslog + "2\n" + exampleSyslog + "3"))
+	c.Assert(err, IsNil)
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.Assert(server.Shutdown(ctx), IsNil)
+	c.Check(handler.contents, DeepEquals, []string{"content1", "content2", "content3"})
+}
+
+// A handler which holds the messages until released, then records them
+type handlerBlocking struct {
+	handlerRecorder
+	release chan struct{}
+}
+
+func (s *handlerBlocking) Handle(logParts format.LogParts, msgLen int64, err error) {
+	<-s.release
+	s.handlerRecorder.Handle(logParts, msgLen, err)
+}
+
+func (s *ServerSuite) TestShutdownDeadline(c *C) {
+	handler := &handlerBlocking{release: make(chan struct{})}
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.ListenUDP("127.0.0.1:0")
+	server.Boot()
+	conn, err := net.Dial("udp", server.connections[0].LocalAddr().String())
+	c.Assert(err, IsNil)
+	_, err = conn.Write([]byte(exampleSyslog))
+	c.Assert(err, IsNil)
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c.Check(server.Shutdown(ctx), Equals, context.DeadlineExceeded)
+	close(handler.release)
+	server.Wait()
+}
+
+func (s *ServerSuite) TestServeCancel(c *C) {
+	handler := new(HandlerMock)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.ListenUDP("127.0.0.1:0")
+	server.ListenTCP("127.0.0.1:0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		conn, _ := net.Dial("udp", server.connections[0].LocalAddr().String())
+		conn.Write([]byte(exampleSyslog))
+		conn.Close()
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	c.Assert(server.Serve(ctx), IsNil)
+	c.Check(handler.LastLogParts["content"], Equals, "content")
+}
+
+func (s *ServerSuite) TestServeShutdownTimeout(c *C) {
+	handler := &handlerBlocking{release: make(chan struct{})}
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetShutdownTimeout(50 * time.Millisecond)
+	server.ListenUDP("127.0.0.1:0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		conn, _ := net.Dial("udp", server.connections[0].LocalAddr().String())
+		conn.Write([]byte(exampleSyslog))
+		conn.Close()
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	c.Check(server.Serve(ctx), Equals, context.DeadlineExceeded)
+	close(handler.release)
+	server.Wait()
+}
+
+func (s *ServerSuite) TestKillTwice(c *C) {
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(new(HandlerMock))
+	server.ListenUDP("127.0.0.1:0")
+	server.ListenTCP("127.0.0.1:0")
+	server.Boot()
+	c.Check(server.Kill(), IsNil)
+	c.Check(server.Kill(), IsNil)
+	server.Wait()
+}
+
+type TypedHandlerMock struct {
+	LastMessage       *format.Message
+	LastMessageLength int64
+	LastError         error
+}
+
+func (s *TypedHandlerMock) HandleMessage(message *format.Message, msgLen int64, err error) {
+	s.LastMessage = message
+	s.LastMessageLength = msgLen
+	s.LastError = err
+}
+
+func (s *ServerSuite) TestUDPTypedHandler(c *C) {
+	handler := new(TypedHandlerMock)
+	server := NewServer()
+	server.SetFormat(Automatic)
+	server.SetTypedHandler(handler)
+	c.Assert(server.Boot(), IsNil)
+	server.goParseDatagrams()
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleRFC5424Syslog), client: "127.0.0.1:45789"}
+	close(server.datagramChannel)
+	server.Wait()
+	c.Check(handler.LastMessage.Hostname, Equals, "mymachine.example.com")
+	c.Check(handler.LastMessage.Facility, Equals, 4)
+	c.Check(handler.LastMessage.AppName, Equals, "su")
+	c.Check(handler.LastMessage.MsgID, Equals, "ID47")
+	c.Check(handler.LastMessage.Message, Equals, "'su root' failed for lonvick on /dev/pts/8")
+	c.Check(handler.LastMessage.Client, Equals, "127.0.0.1:45789")
+	c.Check(string(handler.LastMessage.Raw), Equals, exampleRFC5424Syslog)
+	c.Check(handler.LastMessageLength, Equals, int64(len(exampleRFC5424Syslog)))
+	c.Check(handler.LastError, IsNil)
+}
+
+type handlerPerClient struct {
+	mutex    sync.Mutex
+	contents map[string][]string
+}
+
+func (s *handlerPerClient) Handle(logParts format.LogParts, msgLen int64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	client := logParts["client"].(string)
+	s.contents[client] = append(s.contents[client], logParts["content"].(string))
+}
+
+func (s *ServerSuite) TestUDPWorkersPreserveSourceOrder(c *C) {
+	handler := &handlerPerClient{contents: make(map[string][]string)}
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetDatagramWorkers(4)
+	server.SetPreserveSourceOrder(true)
+	server.goParseDatagrams()
+
+	clients := []string{"10.0.0.1:514", "10.0.0.2:514", "10.0.0.3:514", "10.0.0.4:514", "10.0.0.5:514"}
+	var expected []string
+	for i := 0; i < 100; i++ {
+		expected = append(expected, fmt.Sprintf("content%d", i))
+		for _, client := range clients {
+			server.datagramChannel <- DatagramMessage{message: []byte(fmt.Sprintf("%s%d", exampleSyslog, i)), client: client}
+		}
+	}
+	close(server.datagramChannel)
+	server.Wait()
+
+	for _, client := range clients {
+		c.Check(handler.contents[client], DeepEquals, expected)
+	}
+}
+
+func (s *ServerSuite) TestUDPWorkers(c *C) {
+	handler := &handlerPerClient{contents: make(map[string][]string)}
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetDatagramWorkers(4)
+	server.goParseDatagrams()
+
+	for i := 0; i < 100; i++ {
+		server.datagramChannel <- DatagramMessage{message: []byte(exampleSyslog), client: "10.0.0.1:514"}
+	}
+	close(server.datagramChannel)
+	server.Wait()
+
+	c.Check(len(handler.contents["10.0.0.1:514"]), Equals, 100)
+}
+
+func (s *ServerSuite) TestIncludeMetadata(c *C) {
+	channel := make(LogPartsChannel, 2)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(NewChannelHandler(channel))
+	server.SetIncludeMetadata(true)
+	c.Assert(server.ListenUDP("127.0.0.1:0"), IsNil)
+	c.Assert(server.ListenTCP("127.0.0.1:0"), IsNil)
+	c.Assert(server.SetListenerName("127.0.0.1:0", "local"), IsNil)
+	c.Check(server.SetListenerName("127.0.0.1:514", "remote"), Equals, ErrUnknownListener)
+	c.Assert(server.Boot(), IsNil)
+	defer server.Kill()
+
+	before := time.Now()
+	udp, err := net.Dial("udp", server.connections[0].LocalAddr().String())
+	c.Assert(err, IsNil)
+	udp.Write([]byte(exampleSyslog + "\r\n\x00"))
+	udp.Close()
+
+	tcp, err := net.Dial("tcp", server.listeners[0].Addr().String())
+	c.Assert(err, IsNil)
+	tcp.Write([]byte(exampleSyslog + "\n"))
+	tcp.Close()
+
+	for i := 0; i < 2; i++ {
+		logParts := <-channel
+		c.Check(logParts["raw"], DeepEquals, []byte(exampleSyslog))
+		c.Check(logParts["listener"], Equals, "local")
+		c.Check(logParts["received_at"].(time.Time).Before(before), Equals, false)
+		switch logParts["transport"] {
+		case "udp":
+			c.Check(logParts["local_addr"], Equals, server.connections[0].LocalAddr().String())
+		case "tcp":
+			c.Check(logParts["local_addr"], Equals, server.listeners[0].Addr().String())
+		default:
+			c.Errorf("unexpected transport %v", logParts["transport"])
+		}
+
+		m := format.NewMessage(logParts)
+		c.Check(m.Listener, Equals, "local")
+		c.Check(m.LogParts(), DeepEquals, logParts)
+	}
+}
+
+func (s *ServerSuite) TestNoMetadataByDefault(c *C) {
+	handler := new(HandlerMock)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.goParseDatagrams()
+	server.datagramChannel <- DatagramMessage{message: []byte(exampleSyslog), client: "0.0.0.0"}
+	close(server.datagramChannel)
+	server.Wait()
+
+	for _, key := range []string{"raw", "received_at", "transport", "local_addr", "listener"} {
+		_, ok := handler.LastLogParts[key]
+		c.Check(ok, Equals, false, Commentf(key))
+	}
+}
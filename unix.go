@@ -0,0 +1,134 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+var ErrSocketInUse = errors.New("socket in use")
+
+//Sets the mode and the owner of the socket files created by ListenUnix and
+//ListenUnixgram. A zero mode keeps the one given by the umask, and an uid or
+//gid of -1 is not changed
+func (s *Server) SetUnixSocketPermissions(mode os.FileMode, uid, gid int) {
+	s.unixSocketMode = mode
+	s.unixSocketUid = uid
+	s.unixSocketGid = gid
+}
+
+//Configure the server for listen on an unix stream socket, the frames are
+//ended by a LF or a NUL unless the format has its own framing. A socket file
+//left by a previous process is replaced
+func (s *Server) ListenUnix(addr string) error {
+	if err := removeStaleSocket(addr); err != nil {
+		return err
+	}
+
+	unixAddr, err := net.ResolveUnixAddr("unix", addr)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.ListenUnix("unix", unixAddr)
+	if err != nil {
+		return err
+	}
+
+	if err := s.setSocketPermissions(addr); err != nil {
+		listener.Close()
+		return err
+	}
+
+	if err := s.addListener(listener, addr, "unix"); err != nil {
+		listener.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Removes the socket file at path if no process listens on it anymore
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrSocketInUse, path)
+	}
+
+	if !isConnectionRefused(err) {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func isConnectionRefused(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+
+	return err == syscall.ECONNREFUSED
+}
+
+func (s *Server) setSocketPermissions(path string) error {
+	if strings.HasPrefix(path, "@") {
+		// Abstract sockets have no file
+		return nil
+	}
+
+	if s.unixSocketMode != 0 {
+		if err := os.Chmod(path, s.unixSocketMode); err != nil {
+			return err
+		}
+	}
+
+	if s.unixSocketUid != -1 || s.unixSocketGid != -1 {
+		return os.Chown(path, s.unixSocketUid, s.unixSocketGid)
+	}
+
+	return nil
+}
+
+// Splits the frames ended by a LF or a NUL, as sent by the stream clients of
+// /dev/log, the empty ones are skipped
+func scanLinesOrNUL(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, unixDelimiters); i >= 0 {
+		if i == 0 {
+			return 1, nil, nil
+		}
+		return i + 1, bytes.TrimSuffix(data[:i], []byte{'\r'}), nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	// Request more data
+	return 0, nil, nil
+}
+
+const unixDelimiters = "\n\x00"
@@ -0,0 +1,97 @@
+package syslog
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type UnixSuite struct{}
+
+var _ = Suite(&UnixSuite{})
+
+func (s *UnixSuite) TestListenUnix(c *C) {
+	path := filepath.Join(c.MkDir(), "log")
+	handler := new(handlerRecorder)
+	server := NewServer()
+	server.SetFormat(RFC3164)
+	server.SetHandler(handler)
+	server.SetUnixSocketPermissions(0666, os.Getuid(), -1)
+	c.Assert(server.ListenUnix(path), IsNil)
+	c.Assert(server.Boot(), IsNil)
+
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Check(info.Mode().Perm(), Equals, os.FileMode(0666))
+
+	conn, err := net.Dial("unix", path)
+	c.Assert(err, IsNil)
+	conn.Write([]byte(exampleSyslog + "\x00" + exampleSyslog + "\n\x00" + exampleSyslog))
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	server.Kill()
+	server.Wait()
+
+	c.Assert(handler.logParts, HasLen, 3)
+	for _, logParts := range handler.logParts {
+		c.Check(logParts["content"], Equals, "content")
+	}
+	c.Check(server.Stats().Listeners[0].Transport, Equals, "unix")
+
+	_, err = os.Stat(path)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *UnixSuite) TestStaleSocket(c *C) {
+	path := filepath.Join(c.MkDir(), "log")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	c.Assert(err, IsNil)
+	listener.SetUnlinkOnClose(false)
+	listener.Close()
+
+	server := NewServer()
+	c.Assert(server.ListenUnix(path), IsNil)
+	server.listeners[0].Close()
+}
+
+func (s *UnixSuite) TestSocketInUse(c *C) {
+	path := filepath.Join(c.MkDir(), "log")
+	listener, err := net.Listen("unix", path)
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	server := NewServer()
+	c.Check(errors.Is(server.ListenUnix(path), ErrSocketInUse), Equals, true)
+}
+
+func (s *UnixSuite) TestNotASocket(c *C) {
+	path := filepath.Join(c.MkDir(), "log")
+	c.Assert(ioutil.WriteFile(path, nil, 0600), IsNil)
+
+	server := NewServer()
+	c.Check(server.ListenUnix(path), ErrorMatches, ".*is not a socket")
+}
+
+func (s *UnixSuite) TestScanLinesOrNUL(c *C) {
+	advance, token, err := scanLinesOrNUL([]byte("foo\r\nbar"), false)
+	c.Check(advance, Equals, 5)
+	c.Check(string(token), Equals, "foo")
+	c.Check(err, IsNil)
+
+	advance, token, _ = scanLinesOrNUL([]byte("\x00bar"), false)
+	c.Check(advance, Equals, 1)
+	c.Check(token, IsNil)
+
+	advance, token, _ = scanLinesOrNUL([]byte("bar"), false)
+	c.Check(advance, Equals, 0)
+	c.Check(token, IsNil)
+
+	advance, token, _ = scanLinesOrNUL([]byte("bar"), true)
+	c.Check(advance, Equals, 3)
+	c.Check(string(token), Equals, "bar")
+}